@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+)
+
+// addAdminHandlers adds the endpoints used by operators to inspect and control the running services.
+// Every request must carry token as a bearer token in its Authorization header.
+func addAdminHandlers(mux *http.ServeMux, registry *services.Registry, token string) {
+	mux.Handle("GET /admin/services", requireBearerToken(token, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(registry.Status())
+	}))
+
+	actions := map[string]func(string) error{
+		"poll":   registry.Poll,
+		"pause":  registry.Pause,
+		"resume": registry.Resume,
+		"reset":  registry.Reset,
+	}
+
+	for name, action := range actions {
+		mux.Handle("POST /admin/services/{service}/"+name, requireBearerToken(token, func(w http.ResponseWriter, r *http.Request) {
+			err := action(r.PathValue("service"))
+			if errors.Is(err, services.ErrUnknownService) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+		}))
+	}
+}
+
+func requireBearerToken(token string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	})
+}
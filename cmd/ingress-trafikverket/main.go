@@ -2,60 +2,101 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
-	"sync"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/config"
 	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services/cameras"
 	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services/roadaccidents"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services/roadconditions"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services/situations"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services/trafficflow"
 	weathersvc "github.com/diwise/ingress-trafikverket/internal/pkg/application/services/weather"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/dedup"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/outbox"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
 	"github.com/diwise/service-chassis/pkg/infrastructure/buildinfo"
 	"github.com/diwise/service-chassis/pkg/infrastructure/env"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
 const serviceName string = "ingress-trafikverket"
 
+// the names of the units that run alongside the feeds, which feeds can not be named
+const (
+	outboxUnit string = "outbox"
+	dedupUnit  string = "dedup"
+)
+
 func main() {
 	serviceVersion := buildinfo.SourceVersion()
 	ctx, logger, cleanup := o11y.Init(context.Background(), serviceName, serviceVersion, "json")
 	defer cleanup()
 
-	authenticationKey := env.GetVariableOrDie(ctx, "TFV_API_AUTH_KEY", "API authentication key")
-	trafikverketURL := env.GetVariableOrDie(ctx, "TFV_API_URL", "API URL")
-	countyCode := env.GetVariableOrDefault(ctx, "TFV_COUNTY_CODE", "")
-	weatherBox := env.GetVariableOrDefault(ctx, "TFV_WEATHER_BOX", "527000 6879000, 652500 6950000")
-	contextBrokerURL := env.GetVariableOrDie(ctx, "CONTEXT_BROKER_URL", "context broker URL")
+	cleanupMetrics := setupPrometheusExporterOrDie(ctx)
+	defer cleanupMetrics()
+
+	configFile := env.GetVariableOrDefault(ctx, "CONFIG_FILE", "")
+	cfg := loadConfigOrDie(ctx, configFile)
+	contextBrokerURL := cfg.ContextBroker.URL
 	ctxBrokerClient := client.NewContextBrokerClient(contextBrokerURL, client.Debug("true"))
 
-	ctx, stopAllServices := context.WithCancel(ctx)
+	checkpoints := createCheckpointStoreOrDie(ctx)
+	published := createDedupCacheOrDie(ctx)
+	registry := createRegistryOrDie(ctx, createCircuitBreakersOrDie(ctx), published)
+	pub := createPublisherOrDie(ctx, contextBrokerURL, ctxBrokerClient)
+
+	ob := createOutboxOrDie(ctx, pub, published)
+	if ob != nil {
+		pub = ob
+		registry.Check(outboxUnit, outboxStatus(ob, getOutboxMaxPendingAgeOrDie(ctx)))
+	}
 
-	services := createServices(ctx, authenticationKey, trafikverketURL, countyCode, weatherBox, ctxBrokerClient)
+	units := func(cfg *config.Config) []services.Unit {
+		units := createUnits(cfg, ctxBrokerClient, pub, checkpoints, published, registry)
 
-	var wg sync.WaitGroup
+		// on shutdown the feeds are stopped first, then the outbox that they publish through, and last the
+		// dedup cache that the outbox forgets dropped entities in
+		if ob != nil {
+			units = append(units, services.Unit{
+				Name:      outboxUnit,
+				Create:    func(context.Context) (services.Starter, error) { return ob, nil },
+				StopOrder: 1,
+			})
+		}
+		units = append(units, services.Unit{
+			Name:      dedupUnit,
+			Create:    func(context.Context) (services.Starter, error) { return published, nil },
+			StopOrder: 2,
+		})
+		return units
+	}
 
-	for _, svc := range services {
-		wg.Add(1)
-		go func() {
-			done, err := svc.Start(ctx)
-			if err != nil {
-				logger.Error("failed to start service", "err", err.Error())
-				os.Exit(1)
-			}
-			<-done
-			wg.Done()
-		}()
+	supervisor := services.NewSupervisor(registry)
+
+	// services that fail to start are retried by the supervisor, and reported as not ready until they have started
+	err := supervisor.Apply(ctx, units(cfg)...)
+	if err != nil {
+		logger.Error("failed to start services", "err", err.Error())
 	}
 
 	apiPort := env.GetVariableOrDefault(ctx, "SERVICE_PORT", "8080")
-	mux := setupServeMux(ctx)
+	adminToken := env.GetVariableOrDefault(ctx, "ADMIN_API_TOKEN", "")
+	mux := setupServeMux(ctx, registry, adminToken)
 	webServer := &http.Server{Addr: ":" + apiPort, Handler: mux}
 
 	go func() {
@@ -65,18 +106,30 @@ func main() {
 		}
 	}()
 
+	configChanged := watchConfigFile(ctx, configFile, getConfigWatchIntervalOrDie(ctx))
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	s := <-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
-	logger.Debug("received signal", "signal", s)
+	for running := true; running; {
+		select {
+		case s := <-sigChan:
+			logger.Debug("received signal", "signal", s)
+			if s != syscall.SIGHUP {
+				running = false
+				continue
+			}
+		case <-configChanged:
+			logger.Info("configuration file has changed", "file", configFile)
+		}
 
-	stopAllServices()
+		cfg = reloadConfig(ctx, configFile, cfg, supervisor, units)
+	}
 
 	logger.Info("waiting for all services to shut down...")
-	wg.Wait()
+	supervisor.Stop()
 
-	err := webServer.Shutdown(ctx)
+	err = webServer.Shutdown(ctx)
 	if err != nil {
 		logger.Error("failed to shutdown web server", "err", err.Error())
 	}
@@ -84,49 +137,436 @@ func main() {
 	logger.Info("shutting down")
 }
 
-func createServices(ctx context.Context, authenticationKey, trafikverketURL, countyCode, weatherBox string, ctxBrokerClient client.ContextBrokerClient) []services.Starter {
-	services := make([]services.Starter, 0, 2)
-	logger := logging.GetFromContext(ctx)
+// feedDefinition is everything a feed service is created from, so that a service is restarted whenever
+// any of it changes
+type feedDefinition struct {
+	Trafikverket config.Trafikverket
+	Feed         config.Feed
+}
+
+// createUnits creates the units that the supervisor runs for the enabled feeds in cfg
+func createUnits(cfg *config.Config, ctxBrokerClient client.ContextBrokerClient, pub publisher.Publisher, checkpoints checkpoint.Store, published *dedup.Cache, registry *services.Registry) []services.Unit {
+	units := make([]services.Unit, 0, len(cfg.Feeds))
 
-	if featureIsEnabled(logger, "weather") {
-		services = append(
-			services,
-			weathersvc.NewWeatherService(ctx, authenticationKey, trafikverketURL, weatherBox, ctxBrokerClient),
-		)
+	for _, feed := range cfg.EnabledFeeds() {
+		units = append(units, services.Unit{
+			Name:       feed.Name,
+			Definition: feedDefinition{Trafikverket: cfg.Trafikverket, Feed: feed},
+			Create: func(ctx context.Context) (services.Starter, error) {
+				logging.GetFromContext(ctx).Info("starting feed", "feed", feed.Name, "type", feed.Type)
+				return createService(ctx, cfg, feed, ctxBrokerClient, pub, checkpoints, published, registry)
+			},
+		})
 	}
 
-	if featureIsEnabled(logger, "roadaccident") {
-		services = append(
-			services,
-			roadaccidents.NewService(ctx, authenticationKey, trafikverketURL, countyCode, ctxBrokerClient),
-		)
+	return units
+}
+
+// createService creates the service that ingests a feed, and publishes its entities with pub to the tenants
+// they are routed to, after they have been changed according to the mapping of the feed. Entities that have
+// not changed since they were last published by the feed are skipped.
+func createService(ctx context.Context, cfg *config.Config, feed config.Feed, ctxBrokerClient client.ContextBrokerClient, pub publisher.Publisher, checkpoints checkpoint.Store, published *dedup.Cache, registry *services.Registry) (services.Starter, error) {
+	authenticationKey, trafikverketURL := cfg.Trafikverket.AuthKey, cfg.Trafikverket.URL
+
+	filters, err := feed.Filters()
+	if err != nil {
+		return nil, err
+	}
+
+	area, err := feed.AreaFilter()
+	if err != nil {
+		return nil, err
+	}
+
+	routing, err := feed.Routing()
+	if err != nil {
+		return nil, err
+	}
+
+	pub = publisher.WithTenants(publisher.WithMapping(publisher.WithDeduplication(pub, published, feed.Name), feed.Mapping()), routing)
+
+	switch feed.Type {
+	case config.Weather:
+		return weathersvc.NewWeatherService(
+			ctx, authenticationKey, trafikverketURL, config.DefaultBox, ctxBrokerClient,
+			weathersvc.Name(feed.Name),
+			weathersvc.Interval(feed.PollInterval()),
+			weathersvc.Area(area),
+			weathersvc.Filters(filters...),
+			weathersvc.Streaming(feed.Streaming),
+			weathersvc.Checkpoints(checkpoints),
+			weathersvc.Registry(registry),
+			weathersvc.Wind(windSensors(feed)),
+			weathersvc.RetireAfter(feed.RetirementAge()),
+			weathersvc.Publisher(pub),
+		), nil
+	case config.Camera:
+		return cameras.NewService(
+			ctx, authenticationKey, trafikverketURL, config.DefaultBox, ctxBrokerClient,
+			cameras.Name(feed.Name),
+			cameras.Interval(feed.PollInterval()),
+			cameras.Area(area),
+			cameras.Filters(filters...),
+			cameras.Streaming(feed.Streaming),
+			cameras.Checkpoints(checkpoints),
+			cameras.Registry(registry),
+			cameras.Publisher(pub),
+		), nil
+	case config.RoadAccident:
+		return roadaccidents.NewService(
+			ctx, authenticationKey, trafikverketURL, "", ctxBrokerClient,
+			roadaccidents.Name(feed.Name),
+			roadaccidents.Interval(feed.PollInterval()),
+			roadaccidents.Counties(feed.Counties...),
+			roadaccidents.Filters(filters...),
+			roadaccidents.Streaming(feed.Streaming),
+			roadaccidents.Checkpoints(checkpoints),
+			roadaccidents.Registry(registry),
+			roadaccidents.Publisher(pub),
+		), nil
+	case config.RoadCondition:
+		return roadconditions.NewService(
+			ctx, authenticationKey, trafikverketURL, "", ctxBrokerClient,
+			roadconditions.Name(feed.Name),
+			roadconditions.Interval(feed.PollInterval()),
+			roadconditions.Counties(feed.Counties...),
+			roadconditions.Filters(filters...),
+			roadconditions.Streaming(feed.Streaming),
+			roadconditions.Checkpoints(checkpoints),
+			roadconditions.Registry(registry),
+			roadconditions.Publisher(pub),
+		), nil
+	case config.Situation:
+		return situations.NewService(
+			ctx, authenticationKey, trafikverketURL, "", feed.MessageTypes, ctxBrokerClient,
+			situations.Name(feed.Name),
+			situations.Interval(feed.PollInterval()),
+			situations.Counties(feed.Counties...),
+			situations.Filters(filters...),
+			situations.Streaming(feed.Streaming),
+			situations.Checkpoints(checkpoints),
+			situations.Registry(registry),
+			situations.Publisher(pub),
+		), nil
+	case config.TrafficFlow:
+		return trafficflow.NewService(
+			ctx, authenticationKey, trafikverketURL, "", ctxBrokerClient,
+			trafficflow.Name(feed.Name),
+			trafficflow.Interval(feed.PollInterval()),
+			trafficflow.Counties(feed.Counties...),
+			trafficflow.Filters(filters...),
+			trafficflow.Streaming(feed.Streaming),
+			trafficflow.Checkpoints(checkpoints),
+			trafficflow.Registry(registry),
+			trafficflow.Publisher(pub),
+		), nil
 	}
 
-	return services
+	return nil, fmt.Errorf("unknown feed type %q", feed.Type)
 }
 
-// featureIsEnabled checks wether a given feature is enabled by exanding the feature name into <uppercase>_ENABLED and checking if the corresponding environment variable is set to true.
-//
-//	Ex: weather -> WEATHER_ENABLED
-func featureIsEnabled(logger *slog.Logger, feature string) bool {
-	featureKey := fmt.Sprintf("%s_ENABLED", strings.ToUpper(feature))
-	isEnabled := os.Getenv(featureKey) == "true"
+// windSensors returns how the wind sensors of the weather stations of a feed should be published
+func windSensors(feed config.Feed) weathersvc.WindSensors {
+	if feed.Wind == nil {
+		return weathersvc.WindSensors{}
+	}
 
-	if isEnabled {
-		logger.Info("feature is enabled", "feature", feature)
-	} else {
-		logger.Warn("feature is not enabled", "feature", feature)
+	return weathersvc.WindSensors{
+		Names:     feed.Wind.Sensors,
+		Heights:   feed.Wind.Heights,
+		Aggregate: feed.Wind.Aggregate,
+	}
+}
+
+// loadConfig loads the configuration, and checks it against what the services support
+func loadConfig(configFile string) (*config.Config, error) {
+	return config.Load(configFile, os.LookupEnv,
+		config.MessageTypes(situations.SupportedMessageTypes()),
+		config.ReservedNames(outboxUnit, dedupUnit),
+	)
+}
+
+// loadConfigOrDie loads the feeds to ingest from the YAML file named by CONFIG_FILE, or from the environment
+// variables that configure one feed of each type if CONFIG_FILE is not set, and panics if they are invalid
+func loadConfigOrDie(ctx context.Context, configFile string) *config.Config {
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		msg := fmt.Sprintf("invalid configuration: %s", err.Error())
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	return cfg
+}
+
+// setupPrometheusExporterOrDie makes the metrics of the service available to be scraped from the /metrics
+// endpoint, unless OTEL_EXPORTER_OTLP_ENDPOINT is set and they are exported by the meter provider that
+// o11y.Init has set up. The returned func shuts down the meter provider.
+func setupPrometheusExporterOrDie(ctx context.Context) func() {
+	if env.GetVariableOrDefault(ctx, "OTEL_EXPORTER_OTLP_ENDPOINT", "") != "" {
+		return func() {}
+	}
+
+	exporter, err := prometheus.New()
+	if err != nil {
+		msg := fmt.Sprintf("failed to create prometheus exporter: %s", err.Error())
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter))
+	otel.SetMeterProvider(meterProvider)
+
+	return func() {
+		err := meterProvider.Shutdown(ctx)
+		if err != nil {
+			logging.GetFromContext(ctx).Error("failed to shutdown meter provider", "err", err.Error())
+		}
+	}
+}
+
+// createCheckpointStoreOrDie creates a file based checkpoint store if CHECKPOINT_FILE is set, so that
+// services can resume from their last change id after a restart, or an in-memory store otherwise.
+func createCheckpointStoreOrDie(ctx context.Context) checkpoint.Store {
+	checkpointFile := env.GetVariableOrDefault(ctx, "CHECKPOINT_FILE", "")
+	if checkpointFile == "" {
+		return checkpoint.NewMemoryStore()
+	}
+
+	store, err := checkpoint.NewFileStore(checkpointFile)
+	if err != nil {
+		msg := fmt.Sprintf("failed to open checkpoint file: %s", err.Error())
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
 	}
 
-	return isEnabled
+	return store
 }
 
-func setupServeMux(_ context.Context) *http.ServeMux {
+// createDedupCacheOrDie creates the cache of published entities that is shared by all feeds, so that entities
+// that have not changed are not published again for DEDUP_CACHE_TTL. The cache is kept in DEDUP_CACHE_FILE,
+// if set, so that it survives a restart along with the checkpoints. It is written every
+// DEDUP_CACHE_FLUSH_INTERVAL once started, and when it is stopped.
+func createDedupCacheOrDie(ctx context.Context) *dedup.Cache {
+	ttl, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "DEDUP_CACHE_TTL", "24h"))
+	if err != nil || ttl < 0 {
+		msg := "DEDUP_CACHE_TTL must be a duration, such as 24h, or 0"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	maxEntries, err := strconv.Atoi(env.GetVariableOrDefault(ctx, "DEDUP_CACHE_MAX_ENTRIES", "100000"))
+	if err != nil || maxEntries < 1 {
+		msg := "DEDUP_CACHE_MAX_ENTRIES must be a positive integer"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	flushInterval, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "DEDUP_CACHE_FLUSH_INTERVAL", "1m"))
+	if err != nil || flushInterval <= 0 {
+		msg := "DEDUP_CACHE_FLUSH_INTERVAL must be a positive duration, such as 1m"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	options := []func(*dedup.Cache){dedup.TTL(ttl), dedup.MaxEntries(maxEntries), dedup.FlushInterval(flushInterval)}
+
+	cacheFile := env.GetVariableOrDefault(ctx, "DEDUP_CACHE_FILE", "")
+	if cacheFile == "" {
+		return dedup.NewCache(options...)
+	}
+
+	cache, err := dedup.NewFileCache(cacheFile, options...)
+	if err != nil {
+		msg := fmt.Sprintf("failed to open dedup cache file: %s", err.Error())
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	return cache
+}
+
+// createCircuitBreakersOrDie creates the circuit breakers that pause polling for a service after
+// TFV_CIRCUIT_BREAKER_THRESHOLD consecutive failures to reach the Trafikverket API, for a duration of
+// TFV_CIRCUIT_BREAKER_COOLDOWN.
+func createCircuitBreakersOrDie(ctx context.Context) *services.CircuitBreakers {
+	threshold, err := strconv.Atoi(env.GetVariableOrDefault(ctx, "TFV_CIRCUIT_BREAKER_THRESHOLD", "5"))
+	if err != nil || threshold < 1 {
+		msg := "TFV_CIRCUIT_BREAKER_THRESHOLD must be a positive integer"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	cooldown, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "TFV_CIRCUIT_BREAKER_COOLDOWN", "5m"))
+	if err != nil || cooldown <= 0 {
+		msg := "TFV_CIRCUIT_BREAKER_COOLDOWN must be a positive duration, such as 5m"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	return services.NewCircuitBreakers(threshold, cooldown)
+}
+
+// createRegistryOrDie creates the registry that reports the status of every poller, where a poller is no
+// longer ready after HEALTH_CONSECUTIVE_ERRORS_LIMIT failed polls in a row, or while its circuit breaker is open.
+func createRegistryOrDie(ctx context.Context, breakers *services.CircuitBreakers, published *dedup.Cache) *services.Registry {
+	limit, err := strconv.Atoi(env.GetVariableOrDefault(ctx, "HEALTH_CONSECUTIVE_ERRORS_LIMIT", "3"))
+	if err != nil || limit < 1 {
+		msg := "HEALTH_CONSECUTIVE_ERRORS_LIMIT must be a positive integer"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	// a reset should publish everything again, even if it has not changed
+	return services.NewRegistry(breakers, services.ConsecutiveErrorsLimit(limit), services.OnReset(published.Forget))
+}
+
+// createPublisherOrDie creates a publisher that sends entities to the context broker with batch upserts of at
+// most CONTEXT_BROKER_BATCH_SIZE entities, or one entity at a time if the batch size is set to 0.
+func createPublisherOrDie(ctx context.Context, contextBrokerURL string, ctxBrokerClient client.ContextBrokerClient) publisher.Publisher {
+	batchSize, err := strconv.Atoi(env.GetVariableOrDefault(ctx, "CONTEXT_BROKER_BATCH_SIZE", "50"))
+	if err != nil || batchSize < 0 {
+		msg := "CONTEXT_BROKER_BATCH_SIZE must be a non negative integer"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	if batchSize == 0 {
+		return publisher.NewPublisher(ctxBrokerClient)
+	}
+
+	return publisher.NewPublisher(ctxBrokerClient, publisher.BatchUpsert(contextBrokerURL, batchSize))
+}
+
+// createOutboxOrDie creates an outbox that stores entities in OUTBOX_FILE until they have been delivered by
+// the given publisher, or dropped after OUTBOX_MAX_ATTEMPTS, or returns nil if OUTBOX_FILE is not set.
+// Dropped entities are forgotten by the cache of published entities, so that they are published again.
+func createOutboxOrDie(ctx context.Context, pub publisher.Publisher, published *dedup.Cache) outbox.Outbox {
+	outboxFile := env.GetVariableOrDefault(ctx, "OUTBOX_FILE", "")
+	if outboxFile == "" {
+		return nil
+	}
+
+	maxAttempts, err := strconv.Atoi(env.GetVariableOrDefault(ctx, "OUTBOX_MAX_ATTEMPTS", "20"))
+	if err != nil || maxAttempts < 1 {
+		msg := "OUTBOX_MAX_ATTEMPTS must be a positive integer"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	forget := func(_ context.Context, e publisher.Entity) {
+		published.ForgetKey(publisher.CacheKey(e))
+	}
+
+	ob, err := outbox.NewFileOutbox(outboxFile, pub, outbox.MaxAttempts(maxAttempts), outbox.OnDrop(forget))
+	if err != nil {
+		msg := fmt.Sprintf("failed to open outbox file: %s", err.Error())
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	return ob
+}
+
+// getOutboxMaxPendingAgeOrDie returns how old the oldest entity in the outbox may be before the outbox is
+// reported as not ready, from OUTBOX_MAX_PENDING_AGE
+func getOutboxMaxPendingAgeOrDie(ctx context.Context) time.Duration {
+	maxAge, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "OUTBOX_MAX_PENDING_AGE", "15m"))
+	if err != nil || maxAge <= 0 {
+		msg := "OUTBOX_MAX_PENDING_AGE must be a positive duration, such as 15m"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	return maxAge
+}
+
+// outboxStatus reports the outbox as ready for as long as its oldest pending entity is younger than maxPendingAge,
+// since the feeds only know that their entities have been added to the outbox and not that they have been delivered
+func outboxStatus(ob outbox.Outbox, maxPendingAge time.Duration) func() services.Status {
+	return func() services.Status {
+		delivery := ob.Delivery()
+
+		s := services.Status{
+			Ready:                 delivery.OldestPendingAge < maxPendingAge,
+			State:                 "running",
+			LastSuccessfulPublish: delivery.LastDelivery,
+			ConsecutiveErrors:     delivery.ConsecutiveFailures,
+			LastError:             delivery.LastError,
+			CircuitBreaker:        "closed",
+		}
+
+		if !s.Ready && s.LastError == "" {
+			s.LastError = fmt.Sprintf("%d entities pending, the oldest for %s", delivery.Pending, delivery.OldestPendingAge.Round(time.Second))
+		}
+
+		return s
+	}
+}
+
+func setupServeMux(ctx context.Context, registry *services.Registry, adminToken string) *http.ServeMux {
 	r := http.NewServeMux()
 
+	if adminToken != "" {
+		addAdminHandlers(r, registry, adminToken)
+	} else {
+		logging.GetFromContext(ctx).Warn("admin api is disabled, set ADMIN_API_TOKEN to enable it")
+	}
+
 	r.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		open := map[string]time.Time{}
+		for _, s := range registry.Status() {
+			if s.CircuitBreaker == "open" {
+				open[s.Name] = s.CircuitOpenUntil
+			}
+		}
+
+		if len(open) == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// the service is still alive, but polling is paused for the services whose circuit breakers are open
+		health := struct {
+			Status          string               `json:"status"`
+			CircuitBreakers map[string]time.Time `json:"openCircuitBreakers"`
+		}{
+			Status:          "degraded",
+			CircuitBreakers: open,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(health)
+	})
+
+	metrics.AddHandlers(r)
+
+	r.HandleFunc("GET /health/live", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNoContent)
 	})
 
+	r.HandleFunc("GET /health/ready", func(w http.ResponseWriter, r *http.Request) {
+		statuses, ready := registry.Ready()
+
+		health := struct {
+			Status   string            `json:"status"`
+			Services []services.Status `json:"services"`
+		}{
+			Status:   "ready",
+			Services: statuses,
+		}
+
+		statusCode := http.StatusOK
+		if !ready {
+			health.Status = "not ready"
+			statusCode = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(health)
+	})
+
 	return r
 }
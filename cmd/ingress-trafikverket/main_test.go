@@ -1,11 +1,38 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/matryer/is"
 )
 
 func TestMain(m *testing.M) {
 
 	os.Exit(m.Run())
 }
+
+func TestAdminAPIRequiresBearerToken(t *testing.T) {
+	is := is.New(t)
+	mux := setupServeMux(context.Background(), services.NewRegistry(nil), "secret")
+
+	request := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	is.Equal(request(http.MethodGet, "/admin/services", ""), http.StatusUnauthorized)
+	is.Equal(request(http.MethodGet, "/admin/services", "wrong"), http.StatusUnauthorized)
+	is.Equal(request(http.MethodGet, "/admin/services", "secret"), http.StatusOK)
+	is.Equal(request(http.MethodPost, "/admin/services/weather/reset", "secret"), http.StatusNotFound) // no such service has been registered
+}
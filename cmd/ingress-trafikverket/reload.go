@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/config"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/service-chassis/pkg/infrastructure/env"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// reloadConfig loads the configuration again and makes the supervisor stop the feeds that have been removed,
+// start the feeds that have been added and restart the feeds that have changed. The current configuration
+// is kept, and returned, if the new one is invalid.
+func reloadConfig(ctx context.Context, configFile string, current *config.Config, supervisor *services.Supervisor, units func(*config.Config) []services.Unit) *config.Config {
+	logger := logging.GetFromContext(ctx)
+
+	cfg, err := loadConfig(configFile)
+	if err != nil {
+		logger.Error("failed to reload configuration, keeping the current feeds", "err", err.Error())
+		return current
+	}
+
+	if cfg.ContextBroker != current.ContextBroker {
+		logger.Warn("the context broker can not be changed without a restart, keeping the current one")
+		cfg.ContextBroker = current.ContextBroker
+	}
+
+	err = supervisor.Apply(ctx, units(cfg)...)
+	if err != nil {
+		logger.Error("failed to apply the reloaded configuration", "err", err.Error())
+	}
+
+	logger.Info("configuration reloaded", "feeds", len(cfg.EnabledFeeds()))
+
+	return cfg
+}
+
+// watchConfigFile returns a channel that receives a value whenever the modification time of configFile
+// has changed, as checked on every interval. The channel never receives anything if configFile is empty
+// or interval is zero.
+func watchConfigFile(ctx context.Context, configFile string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	if configFile == "" || interval == 0 {
+		return changed
+	}
+
+	modTime := func() time.Time {
+		fi, err := os.Stat(configFile)
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+
+	go func() {
+		tmr := time.NewTicker(interval)
+		defer tmr.Stop()
+
+		lastModified := modTime()
+
+		for {
+			select {
+			case <-tmr.C:
+			case <-ctx.Done():
+				return
+			}
+
+			// a file that can not be read is left as is, until it has been written again
+			if m := modTime(); !m.IsZero() && !m.Equal(lastModified) {
+				lastModified = m
+
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changed
+}
+
+// getConfigWatchIntervalOrDie returns how often the configuration file should be checked for changes, as
+// given by CONFIG_WATCH_INTERVAL, where 0 turns the check off
+func getConfigWatchIntervalOrDie(ctx context.Context) time.Duration {
+	interval, err := time.ParseDuration(env.GetVariableOrDefault(ctx, "CONFIG_WATCH_INTERVAL", "10s"))
+	if err != nil || interval < 0 {
+		msg := "CONFIG_WATCH_INTERVAL must be a duration, such as 10s, or 0"
+		logging.GetFromContext(ctx).Error(msg)
+		panic(msg)
+	}
+
+	return interval
+}
@@ -0,0 +1,586 @@
+// Package config loads the feeds that should be ingested from Trafikverket, either from a YAML file or,
+// for backwards compatibility, from the environment variables that configure one feed of each type.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/sweref99"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"gopkg.in/yaml.v3"
+)
+
+// The types of feeds that can be ingested
+const (
+	Weather       string = "weather"
+	Camera        string = "camera"
+	RoadAccident  string = "roadaccident"
+	RoadCondition string = "roadcondition"
+	Situation     string = "situation"
+	TrafficFlow   string = "trafficflow"
+)
+
+// FeedTypes lists every type of feed, in the order they are started
+var FeedTypes = []string{Weather, Camera, RoadAccident, RoadCondition, Situation, TrafficFlow}
+
+// DefaultBox is the SWEREF99 TM box that weather stations and cameras are fetched from, unless another area is configured
+const DefaultBox string = "527000 6879000, 652500 6950000"
+
+// DefaultMessageTypes are the situation message types that are ingested, unless others are configured
+const DefaultMessageTypes string = "Vägarbete,Restriktion,Hinder"
+
+const defaultInterval = 30 * time.Second
+
+// Config holds the connection details of Trafikverket and the context broker, and the feeds to ingest
+type Config struct {
+	Trafikverket  Trafikverket  `yaml:"trafikverket"`
+	ContextBroker ContextBroker `yaml:"contextBroker"`
+	Feeds         []Feed        `yaml:"feeds"`
+}
+
+type Trafikverket struct {
+	URL     string `yaml:"url"`
+	AuthKey string `yaml:"authKey"`
+}
+
+type ContextBroker struct {
+	URL string `yaml:"url"`
+}
+
+// Feed is one instance of a service that polls Trafikverket for a type of object. Several feeds of the
+// same type can be configured side by side, as long as their names are unique.
+type Feed struct {
+	// Name identifies the feed in logs, metrics, health reports and checkpoints. Defaults to the service name of its type.
+	Name string `yaml:"name"`
+	Type string `yaml:"type"`
+	// Enabled defaults to true
+	Enabled *bool `yaml:"enabled"`
+	// Interval between polls, such as 30s or 5m
+	Interval  string `yaml:"interval"`
+	Streaming bool   `yaml:"streaming"`
+
+	// Area is a WGS84 box or a WKT polygon in AreaCRS that weather stations and cameras must be within
+	Area    string `yaml:"area"`
+	AreaCRS string `yaml:"areaCrs"`
+	// Box is a SWEREF99 TM box that weather stations and cameras must be within, if no area is given
+	Box string `yaml:"box"`
+	// Counties are the county numbers that road accidents, road conditions, situations and traffic flow are fetched from
+	Counties []string `yaml:"counties"`
+	// Filter is an additional filter expression, see trafikverket.ParseFilter
+	Filter       string   `yaml:"filter"`
+	MessageTypes []string `yaml:"messageTypes"`
+	// Wind chooses the primary wind sensor of weather stations
+	Wind *Wind `yaml:"wind"`
+	// RetireAfter is how long a weather station may be missing from the feed before it is marked inactive,
+	// such as 6h. Stations are never retired if it is not set.
+	RetireAfter string `yaml:"retireAfter"`
+
+	// EntityIDPrefix replaces "se:trafikverket:api:" in the ids of the published entities
+	EntityIDPrefix string `yaml:"entityIdPrefix"`
+	// Attributes renames the published attributes, or removes those that are renamed to an empty string
+	Attributes map[string]string `yaml:"attributes"`
+
+	// Tenant is the NGSI-LD tenant that entities are published to, unless they are routed to another tenant
+	Tenant string `yaml:"tenant"`
+	// Tenants routes entities to other tenants by their county or location. The first matching route is used.
+	Tenants []TenantRoute `yaml:"tenants"`
+}
+
+// TenantRoute routes the entities of a feed that are located in any of the counties, or within the area,
+// to a tenant
+type TenantRoute struct {
+	Tenant   string   `yaml:"tenant"`
+	Counties []string `yaml:"counties"`
+	// Area is a WGS84 box or a WKT polygon in AreaCRS
+	Area    string `yaml:"area"`
+	AreaCRS string `yaml:"areaCrs"`
+}
+
+// Wind chooses the wind sensor of a weather station that is published as its wind direction and speed, by
+// the names of the sensors or by their heights, and whether the speeds of all sensors are summarised
+type Wind struct {
+	Sensors   []string  `yaml:"sensors"`
+	Heights   []float64 `yaml:"heights"`
+	Aggregate bool      `yaml:"aggregate"`
+}
+
+// IsEnabled returns false only if the feed has been explicitly disabled
+func (f Feed) IsEnabled() bool {
+	return f.Enabled == nil || *f.Enabled
+}
+
+// PollInterval returns the parsed interval of the feed, or the default interval of 30 seconds
+func (f Feed) PollInterval() time.Duration {
+	interval, err := time.ParseDuration(f.Interval)
+	if err != nil {
+		return defaultInterval
+	}
+	return interval
+}
+
+// AreaFilter returns a filter on the SWEREF99 TM geometry of objects, for the area of the feed if it is
+// set, or its SWEREF99 TM box otherwise
+func (f Feed) AreaFilter() (trafikverket.Filter, error) {
+	if f.Area == "" {
+		return trafikverket.Within("Geometry.SWEREF99TM", "box", f.box()), nil
+	}
+
+	crs := f.AreaCRS
+	if crs == "" {
+		crs = "WGS84"
+	}
+
+	polygon, err := sweref99.ParseArea(f.Area, crs)
+	if err != nil {
+		return trafikverket.Filter{}, err
+	}
+
+	// the Trafikverket API can only filter on the outer ring of a polygon, and would silently include the holes
+	if len(polygon) > 1 {
+		return trafikverket.Filter{}, errors.New("polygons with holes are not supported, use a polygon with only an outer ring")
+	}
+
+	points := []trafikverket.Point{}
+	for _, pt := range sweref99.TM.FromWGS84Polygon(polygon)[0] {
+		points = append(points, trafikverket.Point{X: pt.X, Y: pt.Y})
+	}
+
+	return trafikverket.WithinPolygon("Geometry.SWEREF99TM", points...), nil
+}
+
+// Filters returns the parsed filter expression of the feed, if any
+func (f Feed) Filters() ([]trafikverket.Filter, error) {
+	if f.Filter == "" {
+		return []trafikverket.Filter{}, nil
+	}
+
+	filter, err := trafikverket.ParseFilter(f.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return []trafikverket.Filter{filter}, nil
+}
+
+// Mapping returns how the entities of the feed should be changed before they are published
+func (f Feed) Mapping() publisher.Mapping {
+	return publisher.Mapping{
+		IDNamespace: f.EntityIDPrefix,
+		Attributes:  f.Attributes,
+	}
+}
+
+// RetirementAge returns how long a weather station may be missing from the feed before it is retired, or
+// zero if stations should never be retired
+func (f Feed) RetirementAge() time.Duration {
+	age, err := time.ParseDuration(f.RetireAfter)
+	if err != nil {
+		return 0
+	}
+	return age
+}
+
+// Routing returns the tenants that the entities of the feed should be published to
+func (f Feed) Routing() (publisher.Routing, error) {
+	routing := publisher.Routing{Tenant: f.Tenant}
+
+	for i, route := range f.Tenants {
+		r := publisher.TenantRoute{Tenant: route.Tenant, Counties: route.Counties}
+
+		if route.Area != "" {
+			crs := route.AreaCRS
+			if crs == "" {
+				crs = "WGS84"
+			}
+
+			area, err := sweref99.ParseArea(route.Area, crs)
+			if err != nil {
+				return publisher.Routing{}, fmt.Errorf("invalid area of tenants[%d]: %w", i, err)
+			}
+			r.Area = area
+		}
+
+		routing.Routes = append(routing.Routes, r)
+	}
+
+	return routing, nil
+}
+
+func (f Feed) box() string {
+	if f.Box == "" {
+		return DefaultBox
+	}
+	return f.Box
+}
+
+// Validator checks the parts of an enabled feed that depend on the service that ingests it
+type Validator func(Feed) error
+
+// MessageTypes returns a Validator that fails on situation feeds with message types that are not supported
+func MessageTypes(supported []string) Validator {
+	return func(f Feed) error {
+		if f.Type != Situation {
+			return nil
+		}
+
+		unsupported := []string{}
+		for _, mt := range f.MessageTypes {
+			if !slices.Contains(supported, mt) {
+				unsupported = append(unsupported, strconv.Quote(mt))
+			}
+		}
+
+		if len(unsupported) > 0 {
+			return fmt.Errorf("unsupported message type %s", strings.Join(unsupported, ", "))
+		}
+
+		return nil
+	}
+}
+
+// ReservedNames returns a Validator that fails on feeds that are named like the services that run alongside
+// the feeds, since a feed and a service with the same name would replace each other
+func ReservedNames(names ...string) Validator {
+	return func(f Feed) error {
+		if slices.Contains(names, f.Name) {
+			return fmt.Errorf("name %q is reserved for an internal service", f.Name)
+		}
+		return nil
+	}
+}
+
+// Load reads the configuration from the YAML file at path, if path is not empty, or builds it from
+// environment variables otherwise. The connection details, and the <TYPE>_ENABLED and
+// <TYPE>_STREAMING_ENABLED variables, override the contents of the file. The configuration is validated,
+// also by the given validators, and all problems are returned in a single error.
+func Load(path string, lookupEnv func(string) (string, bool), validators ...Validator) (*Config, error) {
+	var cfg *Config
+
+	if path == "" {
+		cfg = fromEnvironment(lookupEnv)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open config file: %w", err)
+		}
+		defer f.Close()
+
+		cfg, err = Parse(f)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg.overrideFromEnvironment(lookupEnv)
+	}
+
+	cfg.setDefaults()
+
+	if err := cfg.Validate(validators...); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Parse decodes a YAML configuration, and fails on any unknown field
+func Parse(r io.Reader) (*Config, error) {
+	cfg := &Config{}
+
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	err := decoder.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// fromEnvironment creates one feed of each type that has been enabled with <TYPE>_ENABLED=true
+func fromEnvironment(lookupEnv func(string) (string, bool)) *Config {
+	getenv := func(key, defaultValue string) string {
+		if value, ok := lookupEnv(key); ok && value != "" {
+			return value
+		}
+		return defaultValue
+	}
+
+	cfg := &Config{
+		Trafikverket: Trafikverket{
+			URL:     getenv("TFV_API_URL", ""),
+			AuthKey: getenv("TFV_API_AUTH_KEY", ""),
+		},
+		ContextBroker: ContextBroker{
+			URL: getenv("CONTEXT_BROKER_URL", ""),
+		},
+	}
+
+	countyCode := getenv("TFV_COUNTY_CODE", "")
+	tenant := getenv("CONTEXT_BROKER_TENANT", "")
+
+	for _, feedType := range FeedTypes {
+		enabled := getenv(strings.ToUpper(feedType)+"_ENABLED", "") == "true"
+
+		feed := Feed{
+			Type:      feedType,
+			Enabled:   &enabled,
+			Streaming: getenv(strings.ToUpper(feedType)+"_STREAMING_ENABLED", "") == "true",
+			Filter:    getenv("TFV_"+strings.ToUpper(feedType)+"_FILTER", ""),
+			Tenant:    tenant,
+		}
+
+		if hasArea(feedType) {
+			feed.Area = getenv("TFV_AREA", "")
+			feed.AreaCRS = getenv("TFV_AREA_CRS", "")
+			if feed.Area == "" {
+				feed.Box = getenv("TFV_WEATHER_BOX", DefaultBox)
+			}
+		} else if countyCode != "" {
+			feed.Counties = []string{countyCode}
+		}
+
+		if feedType == Situation {
+			feed.MessageTypes = splitAndTrim(getenv("TFV_SITUATION_MESSAGE_TYPES", DefaultMessageTypes))
+		}
+
+		cfg.Feeds = append(cfg.Feeds, feed)
+	}
+
+	return cfg
+}
+
+// overrideFromEnvironment replaces the connection details, and enables or disables feeds by their type,
+// with any of the environment variables that are set
+func (cfg *Config) overrideFromEnvironment(lookupEnv func(string) (string, bool)) {
+	override := func(key string, value *string) {
+		if v, ok := lookupEnv(key); ok && v != "" {
+			*value = v
+		}
+	}
+
+	override("TFV_API_URL", &cfg.Trafikverket.URL)
+	override("TFV_API_AUTH_KEY", &cfg.Trafikverket.AuthKey)
+	override("CONTEXT_BROKER_URL", &cfg.ContextBroker.URL)
+
+	for i := range cfg.Feeds {
+		feedType := strings.ToUpper(cfg.Feeds[i].Type)
+
+		if v, ok := lookupEnv(feedType + "_ENABLED"); ok && v != "" {
+			enabled := v == "true"
+			cfg.Feeds[i].Enabled = &enabled
+		}
+
+		if v, ok := lookupEnv(feedType + "_STREAMING_ENABLED"); ok && v != "" {
+			cfg.Feeds[i].Streaming = v == "true"
+		}
+	}
+}
+
+func (cfg *Config) setDefaults() {
+	for i := range cfg.Feeds {
+		feed := &cfg.Feeds[i]
+
+		if feed.Name == "" {
+			feed.Name = serviceNames[feed.Type]
+		}
+
+		if feed.Interval == "" {
+			feed.Interval = defaultInterval.String()
+		}
+
+		if feed.Type == Situation && len(feed.MessageTypes) == 0 {
+			feed.MessageTypes = splitAndTrim(DefaultMessageTypes)
+		}
+	}
+}
+
+// serviceNames are the names that feeds are given if they are not named, and that were used before
+// feeds could be configured
+var serviceNames = map[string]string{
+	Weather:       "weather",
+	Camera:        "cameras",
+	RoadAccident:  "roadaccidents",
+	RoadCondition: "roadconditions",
+	Situation:     "situations",
+	TrafficFlow:   "trafficflow",
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Validate checks the configuration, and every enabled feed with the given validators, and returns an error
+// that describes every problem that was found. Apart from their types and names, disabled feeds are not validated.
+func (cfg *Config) Validate(validators ...Validator) error {
+	errs := []error{}
+
+	if cfg.Trafikverket.URL == "" {
+		errs = append(errs, errors.New("trafikverket.url (TFV_API_URL) is required"))
+	}
+
+	if cfg.Trafikverket.AuthKey == "" {
+		errs = append(errs, errors.New("trafikverket.authKey (TFV_API_AUTH_KEY) is required"))
+	}
+
+	if cfg.ContextBroker.URL == "" {
+		errs = append(errs, errors.New("contextBroker.url (CONTEXT_BROKER_URL) is required"))
+	}
+
+	names := map[string]bool{}
+
+	for i, feed := range cfg.Feeds {
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("feeds[%d] (%s): %s", i, feed.Name, fmt.Sprintf(format, args...)))
+		}
+
+		if !slices.Contains(FeedTypes, feed.Type) {
+			invalid("unknown type %q, expected one of %s", feed.Type, strings.Join(FeedTypes, ", "))
+			continue
+		}
+
+		if !validName.MatchString(feed.Name) {
+			invalid("name must only contain lower case letters, digits, '-' and '_'")
+		} else if names[feed.Name] {
+			invalid("name is not unique")
+		}
+		names[feed.Name] = true
+
+		if !feed.IsEnabled() {
+			continue
+		}
+
+		if interval, err := time.ParseDuration(feed.Interval); err != nil {
+			invalid("invalid interval %q", feed.Interval)
+		} else if interval < time.Second {
+			invalid("interval must be at least 1s")
+		}
+
+		if hasArea(feed.Type) {
+			if feed.Area != "" && feed.Box != "" {
+				invalid("area and box can not both be set")
+			} else if feed.Area == "" {
+				if _, err := sweref99.ParseBox(feed.box()); err != nil {
+					invalid("invalid box: %s", err.Error())
+				}
+			} else if _, err := feed.AreaFilter(); err != nil {
+				invalid("invalid area: %s", err.Error())
+			}
+
+			if len(feed.Counties) > 0 {
+				invalid("counties can not be used with feeds of type %s", feed.Type)
+			}
+		} else {
+			if feed.Area != "" || feed.AreaCRS != "" || feed.Box != "" {
+				invalid("area can not be used with feeds of type %s, use counties instead", feed.Type)
+			}
+
+			for _, county := range feed.Counties {
+				if _, err := strconv.Atoi(county); err != nil {
+					invalid("invalid county number %q", county)
+				}
+			}
+		}
+
+		if _, err := feed.Filters(); err != nil {
+			invalid("invalid filter: %s", err.Error())
+		}
+
+		if feed.Type != Situation && len(feed.MessageTypes) > 0 {
+			invalid("messageTypes can only be used with feeds of type %s", Situation)
+		}
+
+		if feed.Wind != nil {
+			if feed.Type != Weather {
+				invalid("wind can only be used with feeds of type %s", Weather)
+			}
+
+			for _, height := range feed.Wind.Heights {
+				if height <= 0 {
+					invalid("invalid wind sensor height %v", height)
+				}
+			}
+		}
+
+		if feed.RetireAfter != "" {
+			if feed.Type != Weather {
+				invalid("retireAfter can only be used with feeds of type %s", Weather)
+			}
+
+			if age, err := time.ParseDuration(feed.RetireAfter); err != nil || age <= 0 {
+				invalid("invalid retireAfter %q", feed.RetireAfter)
+			}
+		}
+
+		if feed.EntityIDPrefix != "" && !strings.HasSuffix(feed.EntityIDPrefix, ":") {
+			invalid("entityIdPrefix must end with ':'")
+		}
+
+		for j, route := range feed.Tenants {
+			if route.Tenant == "" {
+				invalid("tenants[%d] must name a tenant", j)
+			}
+
+			if (len(route.Counties) == 0) == (route.Area == "") {
+				invalid("tenants[%d] must have either counties or an area", j)
+			}
+
+			if len(route.Counties) > 0 && hasArea(feed.Type) {
+				invalid("tenants[%d] can not route feeds of type %s by county, use an area instead", j, feed.Type)
+			}
+
+			for _, county := range route.Counties {
+				if _, err := strconv.Atoi(county); err != nil {
+					invalid("invalid county number %q in tenants[%d]", county, j)
+				}
+			}
+		}
+
+		if _, err := feed.Routing(); err != nil {
+			invalid("%s", err.Error())
+		}
+
+		for _, validate := range validators {
+			if err := validate(feed); err != nil {
+				invalid("%s", err.Error())
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// EnabledFeeds returns the feeds that have not been disabled
+func (cfg *Config) EnabledFeeds() []Feed {
+	enabled := []Feed{}
+	for _, feed := range cfg.Feeds {
+		if feed.IsEnabled() {
+			enabled = append(enabled, feed)
+		}
+	}
+	return enabled
+}
+
+func hasArea(feedType string) bool {
+	return feedType == Weather || feedType == Camera
+}
+
+// splitAndTrim splits a comma separated list of values and removes any surrounding whitespace
+func splitAndTrim(values string) []string {
+	result := []string{}
+
+	for _, v := range strings.Split(values, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
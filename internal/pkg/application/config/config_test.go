@@ -0,0 +1,258 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestLoadFeedsFromFile(t *testing.T) {
+	is := is.New(t)
+
+	path := writeConfig(t, `
+trafikverket:
+  url: https://api.trafikinfo.trafikverket.se/v2/data.xml
+contextBroker:
+  url: http://context-broker
+feeds:
+  - type: weather
+    interval: 1m
+    area: "62.2 17.1, 62.5 17.5"
+    wind:
+      sensors: ["DSW"]
+      heights: [10, 6]
+    retireAfter: 6h
+  - name: accidents-north
+    type: roadaccident
+    counties: ["22", "23"]
+    entityIdPrefix: "se:example:"
+    attributes:
+      description: ""
+  - name: accidents-south
+    type: roadaccident
+    enabled: false
+    counties: ["12"]
+`)
+
+	cfg, err := Load(path, lookup(map[string]string{"TFV_API_AUTH_KEY": "secret"}))
+	is.NoErr(err)
+
+	is.Equal(cfg.Trafikverket.AuthKey, "secret") // the auth key should be set from the environment
+	is.Equal(len(cfg.Feeds), 3)
+	is.Equal(cfg.Feeds[0].Name, "weather") // an unnamed feed should be named after its type
+	is.Equal(cfg.Feeds[0].PollInterval(), time.Minute)
+	is.Equal(cfg.Feeds[0].Wind.Heights, []float64{10, 6})
+	is.Equal(cfg.Feeds[0].RetirementAge(), 6*time.Hour)
+	is.Equal(cfg.Feeds[1].Mapping().IDNamespace, "se:example:")
+
+	enabled := cfg.EnabledFeeds()
+	is.Equal(len(enabled), 2)
+	is.Equal(enabled[1].Name, "accidents-north")
+}
+
+func TestEnvironmentOverridesFile(t *testing.T) {
+	is := is.New(t)
+
+	path := writeConfig(t, `
+trafikverket:
+  url: https://api.trafikinfo.trafikverket.se/v2/data.xml
+  authKey: key
+contextBroker:
+  url: http://context-broker
+feeds:
+  - type: camera
+  - type: trafficflow
+    streaming: true
+`)
+
+	cfg, err := Load(path, lookup(map[string]string{
+		"CONTEXT_BROKER_URL":            "http://other-broker",
+		"CAMERA_ENABLED":                "false",
+		"TRAFFICFLOW_STREAMING_ENABLED": "false",
+	}))
+	is.NoErr(err)
+
+	is.Equal(cfg.ContextBroker.URL, "http://other-broker")
+	is.True(!cfg.Feeds[0].IsEnabled())
+	is.True(!cfg.Feeds[1].Streaming)
+}
+
+func TestLoadFeedsFromEnvironment(t *testing.T) {
+	is := is.New(t)
+
+	cfg, err := Load("", lookup(map[string]string{
+		"TFV_API_URL":          "https://api.trafikinfo.trafikverket.se/v2/data.xml",
+		"TFV_API_AUTH_KEY":     "key",
+		"CONTEXT_BROKER_URL":   "http://context-broker",
+		"TFV_COUNTY_CODE":      "22",
+		"WEATHER_ENABLED":      "true",
+		"SITUATION_ENABLED":    "true",
+		"TFV_SITUATION_FILTER": "EQ(Deviation.SeverityCode, 5)",
+	}))
+	is.NoErr(err)
+
+	enabled := cfg.EnabledFeeds()
+	is.Equal(len(enabled), 2)
+	is.Equal(enabled[0].Box, DefaultBox)
+	is.Equal(enabled[1].Name, "situations")
+	is.Equal(enabled[1].Counties, []string{"22"})
+	is.Equal(enabled[1].MessageTypes, []string{"Vägarbete", "Restriktion", "Hinder"})
+}
+
+func TestTenantRouting(t *testing.T) {
+	is := is.New(t)
+
+	path := writeConfig(t, `
+trafikverket:
+  url: https://api.trafikinfo.trafikverket.se/v2/data.xml
+  authKey: key
+contextBroker:
+  url: http://context-broker
+feeds:
+  - type: roadaccident
+    counties: ["22", "23"]
+    tenant: region
+    tenants:
+      - tenant: jamtland
+        counties: ["23"]
+      - tenant: sundsvall
+        area: "62.2 17.1, 62.5 17.5"
+`)
+
+	cfg, err := Load(path, lookup(nil))
+	is.NoErr(err)
+
+	routing, err := cfg.Feeds[0].Routing()
+	is.NoErr(err)
+	is.Equal(routing.Tenant, "region")
+	is.Equal(len(routing.Routes), 2)
+	is.Equal(routing.Routes[0].Counties, []string{"23"})
+	is.Equal(len(routing.Routes[1].Area[0]), 5) // the box should be a closed ring
+}
+
+func TestWeatherCanNotBeRoutedByCounty(t *testing.T) {
+	is := is.New(t)
+
+	path := writeConfig(t, `
+trafikverket:
+  url: https://api.trafikinfo.trafikverket.se/v2/data.xml
+  authKey: key
+contextBroker:
+  url: http://context-broker
+feeds:
+  - type: weather
+    tenants:
+      - tenant: ostersund
+        counties: ["23"]
+`)
+
+	_, err := Load(path, lookup(nil))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "feeds[0] (weather): tenants[0] can not route feeds of type weather by county"))
+}
+
+func TestInvalidConfigReportsEveryProblem(t *testing.T) {
+	is := is.New(t)
+
+	path := writeConfig(t, `
+trafikverket:
+  url: https://api.trafikinfo.trafikverket.se/v2/data.xml
+  authKey: key
+feeds:
+  - type: weather
+    interval: 10ms
+    retireAfter: soon
+  - name: weather
+    type: weather
+    counties: ["22"]
+  - name: incidents
+    type: roadaccident
+    area: "62.2 17.1, 62.5 17.5"
+    wind:
+      heights: [0]
+  - type: situation
+    messageTypes: ["Olycka", "Unknown"]
+    filter: "EQ(Deviation.SeverityCode"
+  - type: ferries
+  - name: stations
+    type: weather
+    box: "652500 6950000, 527000 6879000"
+  - name: cameras
+    type: camera
+    area: "62.2 17.1, 95.5 17.5"
+  - name: outside
+    type: camera
+    box: "1 2, 3 4"
+  - name: holes
+    type: weather
+    area: "POLYGON ((16.6 62.1, 17.7 62.1, 17.7 62.7, 16.6 62.7, 16.6 62.1), (17.0 62.3, 17.2 62.3, 17.2 62.5, 17.0 62.3))"
+`)
+
+	_, err := Load(path, lookup(nil), MessageTypes([]string{"Vägarbete", "Olycka"}))
+	is.True(err != nil)
+
+	for _, problem := range []string{
+		"contextBroker.url (CONTEXT_BROKER_URL) is required",
+		"feeds[0] (weather): interval must be at least 1s",
+		"feeds[0] (weather): invalid retireAfter \"soon\"",
+		"feeds[1] (weather): name is not unique",
+		"feeds[1] (weather): counties can not be used",
+		"feeds[2] (incidents): area can not be used",
+		"feeds[2] (incidents): wind can only be used",
+		"feeds[2] (incidents): invalid wind sensor height 0",
+		"feeds[3] (situations): unsupported message type \"Unknown\"",
+		"feeds[3] (situations): invalid filter",
+		"feeds[4] (): unknown type \"ferries\"",
+		"feeds[5] (stations): invalid box: the first corner of a box must be south west of the second",
+		"feeds[6] (cameras): invalid area: latitude 95.5 is out of range",
+		"feeds[7] (outside): invalid box: the box \"1 2, 3 4\" is not within the area of SWEREF 99 TM",
+		"feeds[8] (holes): invalid area: polygons with holes are not supported",
+	} {
+		is.True(strings.Contains(err.Error(), problem)) // every problem should be reported
+	}
+}
+
+func TestReservedNamesAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	path := writeConfig(t, `
+trafikverket:
+  url: https://api.trafikinfo.trafikverket.se/v2/data.xml
+  authKey: key
+contextBroker:
+  url: http://context-broker
+feeds:
+  - name: outbox
+    type: weather
+`)
+
+	_, err := Load(path, lookup(nil), ReservedNames("outbox", "dedup"))
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `feeds[0] (outbox): name "outbox" is reserved for an internal service`))
+}
+
+func TestUnknownFieldsAreRejected(t *testing.T) {
+	is := is.New(t)
+
+	_, err := Parse(strings.NewReader("feeds:\n  - type: weather\n    intervall: 1m\n"))
+	is.True(err != nil)
+}
+
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func lookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
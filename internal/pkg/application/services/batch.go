@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// Batch collects the entities that are created from a response, or a streamed event, from the Trafikverket
+// API so that they can be published together.
+//
+// An object that can not be converted into an entity would fail again on every poll of the same change id,
+// so it is logged, counted as failed and left out of the batch. Only entities that fail to be published make
+// Publish return an error, which keeps a Poller from advancing past the change id of the response.
+type Batch struct {
+	ingestion Ingestion
+	entities  []publisher.Entity
+}
+
+// NewBatch creates an empty Batch that counts its converted and published entities with ingestion
+func NewBatch(ingestion Ingestion) *Batch {
+	return &Batch{ingestion: ingestion}
+}
+
+// Convert adds the entity of entityType that is returned by convert to the batch. If convert fails the object
+// is skipped, and logged together with args that identify it.
+func (b *Batch) Convert(ctx context.Context, entityType string, convert func() (publisher.Entity, error), args ...any) {
+	entity, err := convert()
+	if err != nil {
+		args = append([]any{"type", entityType}, args...)
+		logging.GetFromContext(ctx).Error("skipping object that could not be converted", append(args, "err", err.Error())...)
+		b.ingestion.Failed(ctx, entityType, 1)
+		return
+	}
+
+	b.entities = append(b.entities, entity)
+}
+
+// Add adds entities that do not have to be converted, such as those that mark a deleted object as inactive
+func (b *Batch) Add(entities ...publisher.Entity) {
+	b.entities = append(b.entities, entities...)
+}
+
+// Publish publishes the entities in the batch with pub, and returns the errors of the entities that could
+// not be published by id, together with an error if there were any
+func (b *Batch) Publish(ctx context.Context, pub publisher.Publisher) (map[string]error, error) {
+	logger := logging.GetFromContext(ctx)
+
+	errs := pub.Publish(ctx, b.entities...)
+	b.ingestion.Published(ctx, b.entities, errs)
+
+	for _, e := range b.entities {
+		if err, ok := errs[e.ID]; ok {
+			logger.Error("failed to publish entity", "id", e.ID, "type", e.Type, "err", err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs, fmt.Errorf("failed to publish %d entities", len(errs))
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/matryer/is"
+)
+
+func TestThatObjectsThatCanNotBeConvertedAreSkipped(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	pub := &publisherMock{}
+	batch := NewBatch(NewIngestion("test"))
+
+	batch.Convert(ctx, "Device", func() (publisher.Entity, error) {
+		return publisher.Entity{ID: "a", Type: "Device"}, nil
+	}, "id", "a")
+	batch.Convert(ctx, "Device", func() (publisher.Entity, error) {
+		return publisher.Entity{}, errors.New("invalid position")
+	}, "id", "b")
+	batch.Add(publisher.Entity{ID: "c", Type: "Device"})
+
+	errs, err := batch.Publish(ctx, pub)
+	is.NoErr(err)
+	is.Equal(len(errs), 0)
+	is.Equal(pub.published, []string{"a", "c"})
+}
+
+func TestThatEntitiesThatCanNotBePublishedAreReported(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	pub := &publisherMock{errs: map[string]error{"b": errors.New("bad request")}}
+	batch := NewBatch(NewIngestion("test"))
+	batch.Add(publisher.Entity{ID: "a", Type: "Device"}, publisher.Entity{ID: "b", Type: "Device"})
+
+	errs, err := batch.Publish(ctx, pub)
+	is.True(err != nil) // expected an error but got none
+	is.Equal(len(errs), 1)
+	is.True(errs["b"] != nil)
+}
+
+type publisherMock struct {
+	errs      map[string]error
+	published []string
+}
+
+func (p *publisherMock) Publish(ctx context.Context, entities ...publisher.Entity) map[string]error {
+	errs := map[string]error{}
+
+	for _, e := range entities {
+		if err, ok := p.errs[e.ID]; ok {
+			errs[e.ID] = err
+			continue
+		}
+		p.published = append(p.published, e.ID)
+	}
+
+	return errs
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreakers keeps a circuit breaker for each poller, by name, that opens after a number of consecutive
+// polls that failed because the Trafikverket API was unavailable. Polling is paused while a breaker is open.
+type CircuitBreakers struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+	now      func() time.Time
+}
+
+// NewCircuitBreakers creates circuit breakers that open after threshold consecutive failures and stay open
+// for cooldown, or for as long as the API asked for with a Retry-After header, before a poll is tried again
+func NewCircuitBreakers(threshold int, cooldown time.Duration) *CircuitBreakers {
+	return &CircuitBreakers{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+		breakers:  map[string]*circuitBreaker{},
+		now:       time.Now,
+	}
+}
+
+// Open returns the names of the pollers whose circuit breakers are open, and the time when each of them
+// will try to poll again
+func (cb *CircuitBreakers) Open() map[string]time.Time {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	open := map[string]time.Time{}
+	for name, b := range cb.breakers {
+		if b.failures >= cb.threshold {
+			open[name] = b.openUntil
+		}
+	}
+
+	return open
+}
+
+type circuitBreaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// allow returns false while the breaker of a poller is open. Once the cooldown has passed a single poll
+// is allowed, that either closes the breaker or opens it again.
+func (cb *CircuitBreakers) allow(name string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[name]
+	if !ok {
+		return true
+	}
+
+	return !cb.now().Before(b.openUntil)
+}
+
+func (cb *CircuitBreakers) success(name string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	delete(cb.breakers, name)
+}
+
+// failure records a failed poll and returns true if it opened the breaker
+func (cb *CircuitBreakers) failure(name string, retryAfter time.Duration) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b, ok := cb.breakers[name]
+	if !ok {
+		b = &circuitBreaker{}
+		cb.breakers[name] = b
+	}
+
+	b.failures++
+
+	if b.failures < cb.threshold {
+		return false
+	}
+
+	b.openUntil = cb.now().Add(max(cb.cooldown, retryAfter))
+	return true
+}
@@ -0,0 +1,191 @@
+package cameras
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+type CameraSvc interface {
+	services.Starter
+}
+
+type cameraSvc struct {
+	name    string
+	tfv     trafikverket.Client
+	area    trafikverket.Filter
+	filters []trafikverket.Filter
+
+	interval    time.Duration
+	streaming   bool
+	checkpoints checkpoint.Store
+	registry    *services.Registry
+
+	publisher publisher.Publisher
+}
+
+var tracer = otel.Tracer("cameras")
+
+// NewService creates a service that publishes the road cameras within box, given in SWEREF99 TM, as Device entities
+func NewService(_ context.Context, authKey, tfvURL, box string, ctxBroker client.ContextBrokerClient, options ...func(*cameraSvc)) CameraSvc {
+	cs := &cameraSvc{
+		tfv:       trafikverket.NewClient(authKey, tfvURL),
+		area:      trafikverket.Within("Geometry.SWEREF99TM", "box", box),
+		name:      "cameras",
+		interval:  30 * time.Second,
+		publisher: publisher.NewPublisher(ctxBroker),
+	}
+
+	for _, option := range options {
+		option(cs)
+	}
+
+	return cs
+}
+
+// Area replaces the box with another filter on Geometry.SWEREF99TM, such as a polygon
+func Area(area trafikverket.Filter) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.area = area
+	}
+}
+
+// Filters adds filter expressions that are combined with the bounding box when querying for cameras
+func Filters(filters ...trafikverket.Filter) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.filters = append(cs.filters, filters...)
+	}
+}
+
+// Publisher replaces the default publisher, that merges one entity at a time into the context broker
+func Publisher(p publisher.Publisher) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.publisher = p
+	}
+}
+
+// Name replaces the default name, cameras, of the service so that several instances can be told apart
+func Name(name string) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.name = name
+	}
+}
+
+// Interval replaces the default interval of 30 seconds between polls for cameras
+func Interval(interval time.Duration) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.interval = interval
+	}
+}
+
+// Streaming makes the service subscribe to a stream of changes instead of polling every interval
+func Streaming(enabled bool) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.streaming = enabled
+	}
+}
+
+// Checkpoints makes the service resume from, and record, the last published change id in store
+func Checkpoints(store checkpoint.Store) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.checkpoints = store
+	}
+}
+
+// Registry makes the service report its status to registry, and pause polling while the Trafikverket API is unavailable
+func Registry(registry *services.Registry) func(*cameraSvc) {
+	return func(cs *cameraSvc) {
+		cs.registry = registry
+	}
+}
+
+func (cs *cameraSvc) Start(ctx context.Context) (chan struct{}, error) {
+	options := []func(*services.Poller){}
+
+	if cs.streaming {
+		options = append(options, services.Streaming(cs.tfv, cs.publishCameras))
+	}
+
+	if cs.checkpoints != nil {
+		key := cs.name + ":" + cs.newQuery("").Fingerprint()
+		options = append(options, services.Checkpoints(cs.checkpoints, key))
+	}
+
+	if cs.registry != nil {
+		options = append(options, services.Register(cs.registry))
+	}
+
+	return services.NewPoller(cs.name, cs.interval, cs.getAndPublishCameras, options...).Start(ctx)
+}
+
+func (cs *cameraSvc) getAndPublishCameras(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-and-publish")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	resp, err := cs.getCamerasFromTFV(ctx, lastChangeID)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	info, err := cs.publishCameras(ctx, resp)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	return info, nil
+}
+
+// publishCameras publishes the cameras in a response, or a streamed event, from the Trafikverket API
+func (cs *cameraSvc) publishCameras(ctx context.Context, resp []byte) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "publish-cameras")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+	logger.Debug("received response", "body", string(resp))
+
+	tfvResp := &tfvResponse{}
+	err = json.Unmarshal(resp, tfvResp)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	if len(tfvResp.Response.Result) == 0 {
+		err = errors.New("response contained no result")
+		return trafikverket.Info{}, err
+	}
+
+	ingestion := services.NewIngestion(cs.name)
+	ingestion.Fetched(ctx, "Camera", len(tfvResp.Response.Result[0].Camera))
+
+	batch := services.NewBatch(ingestion)
+
+	for _, camera := range tfvResp.Response.Result[0].Camera {
+		ingestion.Observed(camera.PhotoTime)
+
+		batch.Convert(ctx, fiware.DeviceTypeName, func() (publisher.Entity, error) {
+			return newCameraEntity(camera)
+		}, "id", camera.Id)
+	}
+
+	_, err = batch.Publish(ctx, cs.publisher)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	return tfvResp.Response.Result[0].Info, nil
+}
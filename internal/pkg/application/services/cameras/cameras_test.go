@@ -0,0 +1,78 @@
+package cameras
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	test "github.com/diwise/context-broker/pkg/test"
+	. "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/expects"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestThatCamerasAreQueriedWithinTheBox(t *testing.T) {
+	is, _, cs, ms := setupMockCamera(t, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	_, err := cs.getCamerasFromTFV(context.Background(), "0")
+	is.NoErr(err)
+}
+
+func TestThatCamerasArePublishedAsDevices(t *testing.T) {
+	is, cb, cs, ms := setupMockCamera(t, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	info, err := cs.getAndPublishCameras(context.Background(), "0")
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426311386101186965")
+
+	is.Equal(len(cb.CreateEntityCalls()), 2)
+
+	entity := cb.CreateEntityCalls()[0].Entity
+	is.Equal(entity.ID(), "urn:ngsi-ld:Device:se:trafikverket:api:camera:SE_STA_CAMERA_Orion_2200410")
+	is.Equal(entity.Type(), "Device")
+	is.NoErr(entities.ValidateFragmentAttributes(entity, map[string]any{
+		"status":                "on",
+		"direction":             215,
+		"imageURL":              "https://api.trafikinfo.trafikverket.se/v1/Images/TrafficFlowCamera_39627311.Jpeg",
+		"fullSizeImageURL":      "https://api.trafikinfo.trafikverket.se/v1/Images/TrafficFlowCamera_39627311.Jpeg?type=fullsize",
+		"dateLastValueReported": "2024-12-03T07:00:00Z",
+	}))
+
+	is.NoErr(entities.ValidateFragmentAttributes(cb.MergeEntityCalls()[1].Fragment, map[string]any{"status": "off"}))
+}
+
+func setupMockCamera(t *testing.T, tfvCode int, tfvBody string) (*is.I, *test.ContextBrokerClientMock, *cameraSvc, MockService) {
+	is := is.New(t)
+	tfvMock := NewMockServiceThat(
+		Expects(is, expects.RequestBodyContaining(`<WITHIN name="Geometry.SWEREF99TM" shape="box" value="527000 6879000, 652500 6950000"`)),
+		Returns(
+			response.Code(tfvCode),
+			response.Body([]byte(tfvBody)),
+		),
+	)
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return nil, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, ngsierrors.ErrNotFound
+		},
+	}
+
+	cs := NewService(context.Background(), "", tfvMock.URL(), "527000 6879000, 652500 6950000", ctxBroker)
+
+	return is, ctxBroker, cs.(*cameraSvc), tfvMock
+}
+
+const tfvResponseJSON string = `{"RESPONSE":{"RESULT":[{"Camera":[
+	{"Id":"SE_STA_CAMERA_Orion_2200410","Name":"Sundsvall Norra","Description":"Vy mot söder","Type":"Trafikflödeskamera","Active":true,"Deleted":false,"Status":"ok","Direction":215,"PhotoUrl":"https://api.trafikinfo.trafikverket.se/v1/Images/TrafficFlowCamera_39627311.Jpeg","HasFullSizePhoto":true,"PhotoTime":"2024-12-03T08:00:00.000+01:00","ModifiedTime":"2024-12-03T08:00:05.000+01:00","Geometry":{"WGS84":"POINT (17.3058 62.3908)"}},
+	{"Id":"SE_STA_CAMERA_Orion_2200411","Name":"Sundsvall Södra","Type":"Väglagskamera","Active":false,"Deleted":false,"Direction":30,"Geometry":{"WGS84":"POINT (17.3121 62.3953)"}}
+],"INFO":{"LASTCHANGEID":"7426311386101186965"}}]}}`
@@ -0,0 +1,52 @@
+package cameras
+
+import (
+	"context"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+)
+
+func (cs *cameraSvc) getCamerasFromTFV(ctx context.Context, lastChangeID string) ([]byte, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-cameras")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	body, err := cs.tfv.Query(ctx, cs.newQuery(lastChangeID))
+	return body, err
+}
+
+func (cs *cameraSvc) newQuery(lastChangeID string) trafikverket.Query {
+	filters := append(
+		[]trafikverket.Filter{cs.area},
+		cs.filters...,
+	)
+
+	options := []trafikverket.QueryOption{
+		trafikverket.Namespace("road.infrastructure"),
+		trafikverket.ChangeID(lastChangeID),
+		trafikverket.IncludeDeletedObjects(),
+		trafikverket.Where(filters...),
+		trafikverket.Include(
+			"Id",
+			"Name",
+			"Description",
+			"Type",
+			"Active",
+			"Deleted",
+			"Status",
+			"Direction",
+			"PhotoUrl",
+			"HasFullSizePhoto",
+			"PhotoTime",
+			"ModifiedTime",
+			"Geometry.WGS84",
+		),
+	}
+
+	if cs.streaming {
+		options = append(options, trafikverket.SSEURL())
+	}
+
+	return trafikverket.NewQuery("Camera", "1", options...)
+}
@@ -0,0 +1,36 @@
+package cameras
+
+import (
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+)
+
+type geometry struct {
+	Position string `json:"WGS84"`
+}
+
+type tfvCamera struct {
+	Id               string    `json:"Id"`
+	Name             string    `json:"Name"`
+	Description      string    `json:"Description"`
+	Type             string    `json:"Type"`
+	Active           bool      `json:"Active"`
+	Deleted          bool      `json:"Deleted"`
+	Status           string    `json:"Status"`
+	Direction        int       `json:"Direction"`
+	PhotoUrl         string    `json:"PhotoUrl"`
+	HasFullSizePhoto bool      `json:"HasFullSizePhoto"`
+	PhotoTime        time.Time `json:"PhotoTime"`
+	ModifiedTime     time.Time `json:"ModifiedTime"`
+	Geometry         geometry  `json:"Geometry"`
+}
+
+type tfvResponse struct {
+	Response struct {
+		Result []struct {
+			Camera []tfvCamera       `json:"Camera"`
+			Info   trafikverket.Info `json:"INFO"`
+		} `json:"RESULT"`
+	} `json:"RESPONSE"`
+}
@@ -0,0 +1,76 @@
+package cameras
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	geo "github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+)
+
+func newCameraEntity(camera tfvCamera) (publisher.Entity, error) {
+	attributes, err := convertCameraToFiwareEntity(camera)
+	if err != nil {
+		return publisher.Entity{}, fmt.Errorf("failed to create attribute for fiware entity: %s", err.Error())
+	}
+
+	return publisher.Entity{
+		ID:         fiware.DeviceIDPrefix + "se:trafikverket:api:camera:" + camera.Id,
+		Type:       fiware.DeviceTypeName,
+		Attributes: attributes,
+	}, nil
+}
+
+func convertCameraToFiwareEntity(camera tfvCamera) ([]entities.EntityDecoratorFunc, error) {
+	location, err := geo.ParsePoint(camera.Geometry.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	status := map[bool]string{
+		true:  "on",
+		false: "off",
+	}
+
+	attributes := append(
+		make([]entities.EntityDecoratorFunc, 0, 11),
+		geo.Location(location),
+		decorators.Name(camera.Name),
+		decorators.TextList("category", []string{"camera"}),
+		decorators.Status(status[camera.Active && !camera.Deleted]),
+		decorators.Number("direction", float64(camera.Direction)),
+	)
+
+	if camera.Description != "" {
+		attributes = append(attributes, decorators.Description(camera.Description))
+	}
+
+	if camera.Type != "" {
+		attributes = append(attributes, decorators.Text("cameraType", camera.Type))
+	}
+
+	if camera.Status != "" {
+		attributes = append(attributes, decorators.Text("cameraStatus", camera.Status))
+	}
+
+	if camera.PhotoUrl != "" {
+		attributes = append(attributes, decorators.Text("imageURL", camera.PhotoUrl))
+
+		if camera.HasFullSizePhoto {
+			attributes = append(attributes, decorators.Text("fullSizeImageURL", camera.PhotoUrl+"?type=fullsize"))
+		}
+	}
+
+	if !camera.PhotoTime.IsZero() {
+		attributes = append(attributes, decorators.DateLastValueReported(camera.PhotoTime.UTC().Format(time.RFC3339)))
+	}
+
+	if !camera.ModifiedTime.IsZero() {
+		attributes = append(attributes, decorators.DateModified(camera.ModifiedTime.UTC().Format(time.RFC3339)))
+	}
+
+	return attributes, nil
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// ErrUnknownService is returned when a Registry is asked to control a poller that has not been registered
+var ErrUnknownService = errors.New("unknown service")
+
+// control holds the requests from an operator that are applied by a Poller before its next poll
+type control struct {
+	paused bool
+	reset  bool
+}
+
+func (c control) state() string {
+	if c.paused {
+		return "paused"
+	}
+	return "running"
+}
+
+// Poll makes the Poller poll for changes at once, instead of waiting for the next interval. An open stream
+// is closed, so that the Poller goes back to polling.
+func (p *Poller) Poll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.interrupt()
+}
+
+// Pause stops the Poller from polling, and closes any open stream, until it is resumed
+func (p *Poller) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.control.paused = true
+	if p.closeStream != nil {
+		p.closeStream()
+	}
+}
+
+// Resume makes a paused Poller poll for changes at once, and on every interval after that
+func (p *Poller) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.control.paused = false
+	p.interrupt()
+}
+
+// Reset makes the Poller forget its change id, and any stored checkpoint, so that everything is fetched
+// and published again by the next poll. A running Poller polls at once.
+func (p *Poller) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.control.reset = true
+	p.interrupt()
+}
+
+// interrupt closes any open stream and triggers a poll, unless one has already been triggered
+func (p *Poller) interrupt() {
+	if p.closeStream != nil {
+		p.closeStream()
+	}
+
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// takeControl returns true if the Poller is paused, and true if its change id should be reset before the
+// next poll. A requested reset is only returned once, and not until the Poller is resumed.
+func (p *Poller) takeControl() (paused bool, reset bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.control.paused {
+		return true, false
+	}
+
+	reset = p.control.reset
+	p.control.reset = false
+
+	return false, reset
+}
+
+// resetChangeID stores the initial change id in the checkpoint store, if any, and returns it
+func (p *Poller) resetChangeID(ctx context.Context) string {
+	const initialChangeID = "0"
+
+	if p.checkpoints != nil {
+		err := p.checkpoints.Set(ctx, p.checkpointKey, initialChangeID)
+		if err != nil {
+			logging.GetFromContext(ctx).Error("failed to reset checkpoint", "service", p.name, "err", err.Error())
+		}
+	}
+
+	p.mu.Lock()
+	p.health.lastChangeID = initialChangeID
+	p.mu.Unlock()
+
+	return initialChangeID
+}
+
+// Poll makes the named poller poll for changes at once
+func (r *Registry) Poll(name string) error {
+	return r.control(name, (*Poller).Poll)
+}
+
+// Pause stops the named poller from polling until it is resumed
+func (r *Registry) Pause(name string) error {
+	return r.control(name, (*Poller).Pause)
+}
+
+// Resume makes the named poller start polling again
+func (r *Registry) Resume(name string) error {
+	return r.control(name, (*Poller).Resume)
+}
+
+// Reset makes the named poller fetch and publish everything again, starting from the initial change id
+func (r *Registry) Reset(name string) error {
+	err := r.control(name, (*Poller).Reset)
+	if err != nil {
+		return err
+	}
+
+	for _, reset := range r.onReset {
+		reset(name)
+	}
+
+	return nil
+}
+
+func (r *Registry) control(name string, action func(*Poller)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.pollers {
+		if p.name == name {
+			action(p)
+			return nil
+		}
+	}
+
+	return ErrUnknownService
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/matryer/is"
+)
+
+func TestRegistryControlsPollers(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	store := checkpoint.NewMemoryStore()
+	is.NoErr(store.Set(ctx, "key", "5"))
+
+	polled := make(chan string, 10)
+
+	poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+		polled <- lastChangeID
+		return trafikverket.Info{LastChangeID: "6"}, nil
+	}
+
+	forgotten := ""
+	registry := NewRegistry(nil, OnReset(func(name string) { forgotten = name }))
+
+	done, err := NewPoller("test", time.Hour, poll, Checkpoints(store, "key"), Register(registry)).Start(ctx)
+	is.NoErr(err)
+
+	is.NoErr(registry.Poll("test"))
+	is.Equal(<-polled, "5") // a triggered poll should not wait for the interval
+
+	is.NoErr(registry.Pause("test"))
+	is.NoErr(registry.Reset("test"))
+	is.Equal(registry.Status()[0].State, "paused")
+	is.Equal(forgotten, "test") // the reset should be passed on to the OnReset callback
+
+	is.NoErr(registry.Resume("test"))
+	is.Equal(<-polled, "0") // the poll after a reset should start from the initial change id
+
+	cancel()
+	<-done
+
+	is.Equal(registry.Status()[0].LastChangeID, "6")
+	is.Equal(registry.Poll("unknown"), ErrUnknownService)
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Ingestion counts the objects in a response, or a streamed event, from the Trafikverket API as they are
+// fetched, skipped and published by a service, and keeps track of the newest observation among them
+type Ingestion struct {
+	service string
+}
+
+// NewIngestion creates an Ingestion that records metrics for the named service
+func NewIngestion(service string) Ingestion {
+	return Ingestion{service: service}
+}
+
+// Fetched counts n objects of a Trafikverket object type, such as Camera, that were received from the API
+func (in Ingestion) Fetched(ctx context.Context, objectType string, n int) {
+	ingestion.fetched.Add(ctx, int64(n), in.attributes(objectType))
+}
+
+// Skipped counts n objects of a Trafikverket object type that were received but not published, such as
+// deleted objects or objects that have not changed since they were last published
+func (in Ingestion) Skipped(ctx context.Context, objectType string, n int) {
+	ingestion.skipped.Add(ctx, int64(n), in.attributes(objectType))
+}
+
+// Failed counts n entities of an entity type that could not be created from the received objects
+func (in Ingestion) Failed(ctx context.Context, entityType string, n int) {
+	ingestion.failed.Add(ctx, int64(n), in.attributes(entityType))
+}
+
+// Published counts the entities in batch that were published, and those that failed with one of errs,
+// by entity type
+func (in Ingestion) Published(ctx context.Context, batch []publisher.Entity, errs map[string]error) {
+	published := map[string]int{}
+	failed := map[string]int{}
+
+	for _, e := range batch {
+		if _, ok := errs[e.ID]; ok {
+			failed[e.Type]++
+		} else {
+			published[e.Type]++
+		}
+	}
+
+	for entityType, n := range published {
+		ingestion.published.Add(ctx, int64(n), in.attributes(entityType))
+	}
+
+	for entityType, n := range failed {
+		in.Failed(ctx, entityType, n)
+	}
+}
+
+// Observed records the time of an observation, so that the age of the newest observation can be reported
+func (in Ingestion) Observed(observedAt time.Time) {
+	ingestion.mu.Lock()
+	defer ingestion.mu.Unlock()
+
+	if observedAt.After(ingestion.newestObservation[in.service]) {
+		ingestion.newestObservation[in.service] = observedAt
+	}
+}
+
+func (in Ingestion) attributes(entityType string) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.String("service", in.service),
+		attribute.String("type", entityType),
+	)
+}
+
+// restarted counts a restart of the named service by a Supervisor
+func restarted(ctx context.Context, service string) {
+	ingestion.restarts.Add(ctx, 1, metric.WithAttributes(attribute.String("service", service)))
+}
+
+// caughtUp records that a poller has fetched everything up to the newest change id
+func caughtUp(service string) {
+	ingestion.mu.Lock()
+	defer ingestion.mu.Unlock()
+
+	ingestion.caughtUp[service] = time.Now()
+}
+
+type ingestionMetrics struct {
+	fetched   metric.Int64Counter
+	skipped   metric.Int64Counter
+	published metric.Int64Counter
+	failed    metric.Int64Counter
+	restarts  metric.Int64Counter
+
+	mu                sync.Mutex
+	newestObservation map[string]time.Time
+	caughtUp          map[string]time.Time
+}
+
+var ingestion = newIngestionMetrics()
+
+func newIngestionMetrics() *ingestionMetrics {
+	meter := otel.Meter("ingress-trafikverket")
+
+	m := &ingestionMetrics{
+		newestObservation: map[string]time.Time{},
+		caughtUp:          map[string]time.Time{},
+	}
+
+	var err error
+
+	m.fetched, err = meter.Int64Counter(
+		"ingress.entities.fetched",
+		metric.WithDescription("Number of objects received from the Trafikverket API"),
+		metric.WithUnit("{entity}"),
+	)
+	handle(err)
+
+	m.skipped, err = meter.Int64Counter(
+		"ingress.entities.skipped",
+		metric.WithDescription("Number of objects received from the Trafikverket API that were not published"),
+		metric.WithUnit("{entity}"),
+	)
+	handle(err)
+
+	m.restarts, err = meter.Int64Counter(
+		"ingress.service.restarts",
+		metric.WithDescription("Number of times a service has been restarted after it stopped or failed to start"),
+		metric.WithUnit("{restart}"),
+	)
+	handle(err)
+
+	m.published, err = meter.Int64Counter(
+		"ingress.entities.published",
+		metric.WithDescription("Number of entities published to the context broker"),
+		metric.WithUnit("{entity}"),
+	)
+	handle(err)
+
+	m.failed, err = meter.Int64Counter(
+		"ingress.entities.failed",
+		metric.WithDescription("Number of entities that could not be created or published to the context broker"),
+		metric.WithUnit("{entity}"),
+	)
+	handle(err)
+
+	observationAge, err := meter.Float64ObservableGauge(
+		"ingress.newest_observation_age",
+		metric.WithDescription("Time since the newest observation that has been received by a service"),
+		metric.WithUnit("s"),
+	)
+	handle(err)
+
+	changeIDLag, err := meter.Float64ObservableGauge(
+		"ingress.changeid_lag",
+		metric.WithDescription("Time since a service last fetched everything up to the newest change id"),
+		metric.WithUnit("s"),
+	)
+	handle(err)
+
+	_, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		for service, t := range m.newestObservation {
+			observer.ObserveFloat64(observationAge, time.Since(t).Seconds(), metric.WithAttributes(attribute.String("service", service)))
+		}
+
+		for service, t := range m.caughtUp {
+			observer.ObserveFloat64(changeIDLag, time.Since(t).Seconds(), metric.WithAttributes(attribute.String("service", service)))
+		}
+
+		return nil
+	}, observationAge, changeIDLag)
+	handle(err)
+
+	return m
+}
+
+// handle passes errors from creating instruments to the global error handler of OpenTelemetry
+func handle(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/matryer/is"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestIngestionCountsPublishedAndFailedEntitiesByType(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	reader := metricReader()
+	is.NoErr(reader.Collect(ctx, &metricdata.ResourceMetrics{})) // discard anything recorded by other tests
+
+	batch := []publisher.Entity{
+		{ID: "a", Type: "WeatherObserved"},
+		{ID: "b", Type: "WeatherObserved"},
+		{ID: "c", Type: "Device"},
+	}
+
+	ingestion := NewIngestion("test")
+	ingestion.Fetched(ctx, "WeatherMeasurepoint", 4)
+	ingestion.Published(ctx, batch, map[string]error{"b": errors.New("failed")})
+
+	rm := metricdata.ResourceMetrics{}
+	is.NoErr(reader.Collect(ctx, &rm))
+
+	sums := map[string]map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if data, ok := m.Data.(metricdata.Sum[int64]); ok {
+				sums[m.Name] = map[string]int64{}
+				for _, dp := range data.DataPoints {
+					entityType, _ := dp.Attributes.Value("type")
+					sums[m.Name][entityType.AsString()] = dp.Value
+				}
+			}
+		}
+	}
+
+	is.Equal(sums["ingress.entities.fetched"], map[string]int64{"WeatherMeasurepoint": 4})
+	is.Equal(sums["ingress.entities.published"], map[string]int64{"WeatherObserved": 1, "Device": 1})
+	is.Equal(sums["ingress.entities.failed"], map[string]int64{"WeatherObserved": 1})
+}
+
+// metricReader returns a reader of delta sums from the global meter provider, that is only set once since
+// the instruments of the package are bound to the first provider that is set
+var metricReader = sync.OnceValue(func() *sdkmetric.ManualReader {
+	reader := sdkmetric.NewManualReader(sdkmetric.WithTemporalitySelector(func(sdkmetric.InstrumentKind) metricdata.Temporality {
+		return metricdata.DeltaTemporality
+	}))
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	return reader
+})
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// PollFunc fetches and publishes everything that has changed since lastChangeID and returns
+// the INFO of the response, containing the new change id and an optional stream URL.
+type PollFunc func(ctx context.Context, lastChangeID string) (trafikverket.Info, error)
+
+// EventFunc publishes the contents of a single event received from a stream. The returned
+// INFO may lack a change id if the event did not contain one.
+type EventFunc func(ctx context.Context, event []byte) (trafikverket.Info, error)
+
+// Poller calls its PollFunc on every interval with the change id of the last changes that were published. A poll
+// that returns an error is retried from the same change id, so it should only fail for reasons that may go away,
+// such as entities that could not be published, and not for objects that could never be converted, see Batch.
+type Poller struct {
+	name     string
+	interval time.Duration
+	poll     PollFunc
+
+	tfv     trafikverket.Client
+	onEvent EventFunc
+
+	checkpoints   checkpoint.Store
+	checkpointKey string
+
+	breakers *CircuitBreakers
+	registry *Registry
+
+	trigger chan struct{}
+
+	mu          sync.Mutex
+	health      health
+	control     control
+	closeStream context.CancelFunc
+}
+
+// health is the outcome of the most recent polls, as reported by a Registry
+type health struct {
+	lastChangeID      string
+	lastFetch         time.Time
+	lastPublish       time.Time
+	consecutiveErrors int
+	lastError         string
+}
+
+// NewPoller creates a Poller that calls poll with the most recent change id on every interval
+func NewPoller(name string, interval time.Duration, poll PollFunc, options ...func(*Poller)) *Poller {
+	p := &Poller{
+		name:     name,
+		interval: interval,
+		poll:     poll,
+		trigger:  make(chan struct{}, 1),
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// Streaming makes the Poller subscribe to the stream URL returned by a poll, passing each event
+// to onEvent, and only go back to polling when the stream is disconnected.
+func Streaming(tfv trafikverket.Client, onEvent EventFunc) func(*Poller) {
+	return func(p *Poller) {
+		p.tfv = tfv
+		p.onEvent = onEvent
+	}
+}
+
+// Checkpoints makes the Poller resume from the change id stored under key, and store every
+// new change id once all changes up to it have been successfully published.
+func Checkpoints(store checkpoint.Store, key string) func(*Poller) {
+	return func(p *Poller) {
+		p.checkpoints = store
+		p.checkpointKey = key
+	}
+}
+
+// CircuitBreaker makes the Poller pause polling while its breaker in breakers is open
+func CircuitBreaker(breakers *CircuitBreakers) func(*Poller) {
+	return func(p *Poller) {
+		p.breakers = breakers
+	}
+}
+
+// Register makes the Poller report its status to registry, and pause polling while its breaker in the
+// circuit breakers of the registry is open
+func Register(registry *Registry) func(*Poller) {
+	return func(p *Poller) {
+		p.registry = registry
+		if registry.breakers != nil {
+			p.breakers = registry.breakers
+		}
+	}
+}
+
+func (p *Poller) Start(ctx context.Context) (chan struct{}, error) {
+	lastChangeID := "0"
+	logger := logging.GetFromContext(ctx).With("service", p.name)
+
+	if p.checkpoints != nil {
+		changeID, err := p.checkpoints.Get(ctx, p.checkpointKey)
+		if err != nil && !errors.Is(err, checkpoint.ErrNotFound) {
+			return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+		}
+
+		if changeID != "" {
+			logger.Info("resuming from checkpoint", "changeid", changeID)
+			lastChangeID = changeID
+		}
+	}
+
+	p.mu.Lock()
+	p.health.lastChangeID = lastChangeID
+	p.mu.Unlock()
+
+	if p.registry != nil {
+		p.registry.register(p)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		tmr := time.NewTicker(p.interval)
+
+		// a panic, such as one caused by an unexpected response, stops the Poller so that it can be
+		// restarted by a Supervisor, instead of taking down every other service
+		defer func() {
+			tmr.Stop()
+
+			if r := recover(); r != nil {
+				logger.Error("poller stopped after a panic", "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+
+				p.mu.Lock()
+				p.health.consecutiveErrors++
+				p.health.lastError = fmt.Sprintf("panic: %v", r)
+				p.mu.Unlock()
+			}
+
+			done <- struct{}{}
+		}()
+
+		for {
+			select {
+			case <-tmr.C:
+			case <-p.trigger:
+			case <-ctx.Done():
+				return
+			}
+
+			paused, reset := p.takeControl()
+			if paused {
+				continue
+			}
+
+			if reset {
+				logger.Info("resetting change id to force a full resync")
+				lastChangeID = p.resetChangeID(ctx)
+			}
+
+			if p.breakers != nil && !p.breakers.allow(p.name) {
+				continue
+			}
+
+			info, err := p.poll(ctx, lastChangeID)
+			p.recordOutcome(ctx, err)
+			if err != nil {
+				logger.Error("failed to get and publish changes", "err", err.Error())
+				continue
+			}
+
+			lastChangeID = p.advance(ctx, lastChangeID, info.LastChangeID)
+
+			if p.onEvent != nil && info.SSEURL != "" {
+				lastChangeID = p.stream(ctx, info.SSEURL, lastChangeID)
+				tmr.Reset(p.interval)
+			}
+		}
+	}()
+
+	return done, nil
+}
+
+func (p *Poller) stream(ctx context.Context, sseURL, lastChangeID string) string {
+	logger := logging.GetFromContext(ctx).With("service", p.name)
+	logger.Info("subscribing to stream of changes")
+
+	// a failed event closes the stream so that the change id does not advance past it,
+	// and the changes are fetched again by the next poll
+	streamCtx, closeStream := context.WithCancel(ctx)
+	defer closeStream()
+
+	// the stream is also closed when the Poller is paused, reset or asked to poll
+	p.mu.Lock()
+	p.closeStream = closeStream
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.closeStream = nil
+		p.mu.Unlock()
+	}()
+
+	// events that were already received when the stream is closed must not be published either,
+	// or the change id would advance past the failed event
+	failed := false
+
+	err := p.tfv.Stream(streamCtx, sseURL, func(ctx context.Context, event []byte) {
+		if failed {
+			return
+		}
+
+		info, err := p.onEvent(ctx, event)
+		if err != nil {
+			logger.Error("failed to publish streamed changes, closing stream", "err", err.Error())
+			failed = true
+			closeStream()
+			return
+		}
+
+		if info.LastChangeID != "" {
+			lastChangeID = p.advance(ctx, lastChangeID, info.LastChangeID)
+		}
+	})
+
+	if err != nil {
+		logger.Warn("stream disconnected, falling back to polling", "err", err.Error())
+	}
+
+	return lastChangeID
+}
+
+// recordOutcome updates the health and the circuit breaker of the Poller, if any, with the result of a poll.
+// Only failures to reach the Trafikverket API count towards opening the breaker.
+func (p *Poller) recordOutcome(ctx context.Context, err error) {
+	p.recordHealth(err)
+
+	if p.breakers == nil {
+		return
+	}
+
+	if !errors.Is(err, trafikverket.ErrUnavailable) {
+		p.breakers.success(p.name)
+		return
+	}
+
+	if p.breakers.failure(p.name, trafikverket.RetryAfter(err)) {
+		logging.GetFromContext(ctx).Warn("trafikverket api unavailable, pausing polling", "service", p.name, "until", p.breakers.Open()[p.name].Format(time.RFC3339))
+	}
+}
+
+// advance records a new change id in the checkpoint store, if any, and returns it
+func (p *Poller) advance(ctx context.Context, lastChangeID, changeID string) string {
+	caughtUp(p.name)
+
+	p.mu.Lock()
+	p.health.lastChangeID = changeID
+	p.mu.Unlock()
+
+	if p.checkpoints != nil && changeID != lastChangeID {
+		err := p.checkpoints.Set(ctx, p.checkpointKey, changeID)
+		if err != nil {
+			logging.GetFromContext(ctx).Error("failed to store checkpoint", "service", p.name, "err", err.Error())
+		}
+	}
+
+	return changeID
+}
+
+// recordHealth updates the health of the Poller with the result of a poll. A poll that failed for any other
+// reason than a failed request to the Trafikverket API has fetched its changes, but failed to publish them.
+func (p *Poller) recordHealth(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	if err == nil {
+		p.health.lastFetch = now
+		p.health.lastPublish = now
+		p.health.consecutiveErrors = 0
+		p.health.lastError = ""
+		return
+	}
+
+	if !errors.Is(err, trafikverket.ErrRequestFailed) {
+		p.health.lastFetch = now
+	}
+
+	p.health.consecutiveErrors++
+	p.health.lastError = err.Error()
+}
+
+func (p *Poller) status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Status{
+		Name:                  p.name,
+		State:                 p.control.state(),
+		Interval:              p.interval.String(),
+		LastChangeID:          p.health.lastChangeID,
+		LastSuccessfulFetch:   p.health.lastFetch,
+		LastSuccessfulPublish: p.health.lastPublish,
+		ConsecutiveErrors:     p.health.consecutiveErrors,
+		LastError:             p.health.lastError,
+	}
+}
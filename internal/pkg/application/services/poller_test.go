@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/matryer/is"
+)
+
+func TestPollerFallsBackToPollingWhenStreamIsDisconnected(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mu := sync.Mutex{}
+	polledChangeIDs := []string{}
+
+	poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		polledChangeIDs = append(polledChangeIDs, lastChangeID)
+		if len(polledChangeIDs) == 2 {
+			cancel()
+		}
+
+		return trafikverket.Info{LastChangeID: "1", SSEURL: "https://sse.example.com"}, nil
+	}
+
+	onEvent := func(ctx context.Context, event []byte) (trafikverket.Info, error) {
+		return trafikverket.Info{LastChangeID: string(event)}, nil
+	}
+
+	tfv := &streamingClient{events: []string{"2", "3"}}
+
+	done, err := NewPoller("test", time.Millisecond, poll, Streaming(tfv, onEvent)).Start(ctx)
+	is.NoErr(err)
+	<-done
+
+	is.Equal(polledChangeIDs, []string{"0", "3"}) // second poll should continue from the last streamed change id
+}
+
+func TestPollerIgnoresStreamedEventsAfterAFailedEvent(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mu := sync.Mutex{}
+	polledChangeIDs := []string{}
+
+	poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		polledChangeIDs = append(polledChangeIDs, lastChangeID)
+		if len(polledChangeIDs) == 2 {
+			cancel()
+		}
+
+		return trafikverket.Info{LastChangeID: "1", SSEURL: "https://sse.example.com"}, nil
+	}
+
+	onEvent := func(ctx context.Context, event []byte) (trafikverket.Info, error) {
+		if string(event) == "2" {
+			return trafikverket.Info{}, errors.New("failed to publish")
+		}
+		return trafikverket.Info{LastChangeID: string(event)}, nil
+	}
+
+	tfv := &streamingClient{events: []string{"2", "3"}}
+
+	done, err := NewPoller("test", time.Millisecond, poll, Streaming(tfv, onEvent)).Start(ctx)
+	is.NoErr(err)
+	<-done
+
+	is.Equal(polledChangeIDs, []string{"0", "1"}) // the change id should not advance past the failed event
+}
+
+type streamingClient struct {
+	events []string
+}
+
+func (c *streamingClient) Query(ctx context.Context, queries ...trafikverket.Query) ([]byte, error) {
+	return nil, nil
+}
+
+func (c *streamingClient) Stream(ctx context.Context, sseURL string, onEvent func(ctx context.Context, data []byte)) error {
+	for _, e := range c.events {
+		onEvent(ctx, []byte(e))
+	}
+	return trafikverket.ErrStreamClosed
+}
+
+func TestPollerResumesFromAndRecordsCheckpoints(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	store := checkpoint.NewMemoryStore()
+	is.NoErr(store.Set(ctx, "key", "5"))
+
+	polledChangeIDs := []string{}
+
+	poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+		polledChangeIDs = append(polledChangeIDs, lastChangeID)
+
+		switch len(polledChangeIDs) {
+		case 1:
+			return trafikverket.Info{LastChangeID: "6"}, nil
+		case 2:
+			return trafikverket.Info{}, errors.New("failed to publish all entities")
+		default:
+			cancel()
+			return trafikverket.Info{LastChangeID: "7"}, nil
+		}
+	}
+
+	done, err := NewPoller("test", time.Millisecond, poll, Checkpoints(store, "key")).Start(ctx)
+	is.NoErr(err)
+	<-done
+
+	is.Equal(polledChangeIDs, []string{"5", "6", "6"}) // a failed poll should be retried from the same change id
+
+	changeID, _ := store.Get(context.Background(), "key")
+	is.Equal(changeID, "7")
+}
+
+func TestPollerPausesWhileCircuitBreakerIsOpen(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	now := time.Now()
+	breakers := NewCircuitBreakers(2, time.Minute)
+	breakers.now = func() time.Time { return now }
+
+	mu := sync.Mutex{}
+	polls := 0
+
+	poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		polls++
+		return trafikverket.Info{}, fmt.Errorf("request failed: %w", trafikverket.ErrUnavailable)
+	}
+
+	done, err := NewPoller("test", time.Millisecond, poll, CircuitBreaker(breakers)).Start(ctx)
+	is.NoErr(err)
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	is.Equal(polls, 2) // polling should be paused after the second failure
+	is.Equal(breakers.Open(), map[string]time.Time{"test": now.Add(time.Minute)})
+
+	breakers.now = func() time.Time { return now.Add(time.Minute) }
+	is.True(breakers.allow("test")) // a poll should be allowed once the cooldown has passed
+
+	breakers.success("test")
+	is.Equal(len(breakers.Open()), 0)
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry keeps track of the pollers that have been started, so that their status can be reported,
+// and holds the circuit breakers that pause them while the Trafikverket API is unavailable
+type Registry struct {
+	breakers    *CircuitBreakers
+	errorsLimit int
+	onReset     []func(name string)
+
+	mu          sync.Mutex
+	pollers     []*Poller
+	checks      map[string]func() Status
+	supervision map[string]supervision
+}
+
+// supervision is the state of a service as reported by a Supervisor
+type supervision struct {
+	state       string
+	restarts    int
+	lastRestart time.Time
+	lastError   string
+}
+
+// NewRegistry creates a Registry that pauses its pollers with breakers, if not nil
+func NewRegistry(breakers *CircuitBreakers, options ...func(*Registry)) *Registry {
+	r := &Registry{
+		breakers:    breakers,
+		errorsLimit: 3,
+		checks:      map[string]func() Status{},
+		supervision: map[string]supervision{},
+	}
+
+	for _, option := range options {
+		option(r)
+	}
+
+	return r
+}
+
+// OnReset calls reset with the name of a poller whenever it is reset through the Registry, so that anything
+// else that is remembered about what the poller has published can be forgotten as well
+func OnReset(reset func(name string)) func(*Registry) {
+	return func(r *Registry) {
+		r.onReset = append(r.onReset, reset)
+	}
+}
+
+// Check reports the status of a service that is not a poller, such as an outbox, as returned by check.
+// The service is only ready if check says so and it is not being restarted.
+func (r *Registry) Check(name string, check func() Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = check
+}
+
+// ConsecutiveErrorsLimit sets how many polls in a row that may fail before a poller is no longer ready
+func ConsecutiveErrorsLimit(limit int) func(*Registry) {
+	return func(r *Registry) {
+		r.errorsLimit = max(limit, 1)
+	}
+}
+
+// Status is the health of a single poller
+type Status struct {
+	Name                  string    `json:"name"`
+	Ready                 bool      `json:"ready"`
+	State                 string    `json:"state"`
+	Interval              string    `json:"interval"`
+	LastChangeID          string    `json:"lastChangeId"`
+	LastSuccessfulFetch   time.Time `json:"lastSuccessfulFetch,omitzero"`
+	LastSuccessfulPublish time.Time `json:"lastSuccessfulPublish,omitzero"`
+	ConsecutiveErrors     int       `json:"consecutiveErrors"`
+	LastError             string    `json:"lastError,omitempty"`
+	CircuitBreaker        string    `json:"circuitBreaker"`
+	CircuitOpenUntil      time.Time `json:"circuitOpenUntil,omitzero"`
+	Restarts              int       `json:"restarts"`
+	LastRestart           time.Time `json:"lastRestart,omitzero"`
+}
+
+// Status returns the status of every registered poller, sorted by name
+func (r *Registry) Status() []Status {
+	r.mu.Lock()
+	pollers := slices.Clone(r.pollers)
+	checks := maps.Clone(r.checks)
+	supervised := maps.Clone(r.supervision)
+	r.mu.Unlock()
+
+	open := map[string]time.Time{}
+	if r.breakers != nil {
+		open = r.breakers.Open()
+	}
+
+	statuses := make([]Status, 0, len(pollers))
+
+	for _, p := range pollers {
+		s := p.status()
+		s.CircuitBreaker = "closed"
+
+		if until, ok := open[p.name]; ok {
+			s.CircuitBreaker = "open"
+			s.CircuitOpenUntil = until
+		}
+
+		if sv, ok := supervised[p.name]; ok {
+			delete(supervised, p.name)
+			s.Restarts, s.LastRestart = sv.restarts, sv.lastRestart
+
+			// the last error of a poller that has stopped, such as a panic, tells more than that it has stopped
+			if sv.state == "restarting" {
+				s.State = sv.state
+				if s.LastError == "" {
+					s.LastError = sv.lastError
+				}
+			}
+		}
+
+		s.Ready = s.State == "paused" || (s.State == "running" && s.CircuitBreaker == "closed" && s.ConsecutiveErrors < r.errorsLimit)
+		statuses = append(statuses, s)
+	}
+
+	for name, check := range checks {
+		s := check()
+		s.Name = name
+
+		if sv, ok := supervised[name]; ok {
+			delete(supervised, name)
+			s.Restarts, s.LastRestart = sv.restarts, sv.lastRestart
+
+			if sv.state == "restarting" {
+				s.State, s.Ready = sv.state, false
+				if s.LastError == "" {
+					s.LastError = sv.lastError
+				}
+			}
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	// other services that are not pollers, or that have not been started yet, are only reported while restarting
+	for name, sv := range supervised {
+		if sv.state == "restarting" {
+			statuses = append(statuses, Status{
+				Name:           name,
+				State:          sv.state,
+				LastError:      sv.lastError,
+				CircuitBreaker: "closed",
+				Restarts:       sv.restarts,
+				LastRestart:    sv.lastRestart,
+			})
+		}
+	}
+
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return statuses
+}
+
+// Ready returns the status of every registered poller and true if all of them are ready
+func (r *Registry) Ready() ([]Status, bool) {
+	statuses := r.Status()
+
+	for _, s := range statuses {
+		if !s.Ready {
+			return statuses, false
+		}
+	}
+
+	return statuses, true
+}
+
+func (r *Registry) register(p *Poller) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// a poller that is restarted replaces the one it was restarted from
+	r.pollers = slices.DeleteFunc(r.pollers, func(registered *Poller) bool {
+		return registered.name == p.name
+	})
+	r.pollers = append(r.pollers, p)
+}
+
+// supervised records the state of a supervised service, and counts a restart if restarted is true
+func (r *Registry) supervised(name, state, lastError string, restarted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sv := r.supervision[name]
+	sv.state, sv.lastError = state, lastError
+
+	if restarted {
+		sv.restarts++
+		sv.lastRestart = time.Now()
+	}
+
+	r.supervision[name] = sv
+}
+
+// remove stops reporting the status of the named service
+func (r *Registry) remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.supervision, name)
+
+	r.pollers = slices.DeleteFunc(r.pollers, func(registered *Poller) bool {
+		return registered.name == name
+	})
+}
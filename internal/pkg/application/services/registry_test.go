@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/matryer/is"
+)
+
+func TestRegistryReportsPollersThatKeepFailingAsNotReady(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	registry := NewRegistry(nil, ConsecutiveErrorsLimit(2))
+	polls := 0
+
+	poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+		polls++
+
+		switch polls {
+		case 1:
+			return trafikverket.Info{LastChangeID: "1"}, nil
+		case 2:
+			return trafikverket.Info{}, errors.New("failed to publish 1 entity")
+		default:
+			cancel()
+			return trafikverket.Info{}, fmt.Errorf("request failed: %w", trafikverket.ErrRequestFailed)
+		}
+	}
+
+	done, err := NewPoller("test", time.Millisecond, poll, Register(registry)).Start(ctx)
+	is.NoErr(err)
+	<-done
+
+	statuses, ready := registry.Ready()
+	is.True(!ready) // the poller should not be ready after two failed polls in a row
+
+	is.Equal(len(statuses), 1)
+	is.Equal(statuses[0].ConsecutiveErrors, 2)
+	is.Equal(statuses[0].CircuitBreaker, "closed")
+	is.True(statuses[0].LastSuccessfulFetch.After(statuses[0].LastSuccessfulPublish)) // the second poll fetched changes, but failed to publish them
+}
+
+func TestRegistryReportsChecksOfOtherServices(t *testing.T) {
+	is := is.New(t)
+
+	registry := NewRegistry(nil)
+	delivered := time.Now().Add(-time.Hour)
+
+	registry.Check("outbox", func() Status {
+		return Status{State: "running", LastSuccessfulPublish: delivered, LastError: "context broker unavailable"}
+	})
+
+	statuses, ready := registry.Ready()
+	is.True(!ready) // a check that is not ready should make the registry not ready
+
+	is.Equal(len(statuses), 1)
+	is.Equal(statuses[0].Name, "outbox")
+	is.Equal(statuses[0].LastSuccessfulPublish, delivered)
+
+	registry.Check("outbox", func() Status { return Status{State: "running", Ready: true} })
+	registry.supervised("outbox", "restarting", "service stopped unexpectedly", true)
+
+	statuses, ready = registry.Ready()
+	is.True(!ready) // a service that is restarting should not be ready
+	is.Equal(statuses[0].Restarts, 1)
+}
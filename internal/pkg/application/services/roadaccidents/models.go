@@ -1,11 +1,18 @@
 package roadaccidents
 
+import "github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+
 type tfvPoint struct {
 	WGS84 string `json:"WGS84"`
 }
 
+type tfvLine struct {
+	WGS84 string `json:"WGS84"`
+}
+
 type tfvGeometry struct {
 	Point tfvPoint `json:"Point"`
+	Line  tfvLine  `json:"Line"`
 }
 
 const (
@@ -20,6 +27,7 @@ type tfvDeviation struct {
 	EndTime   string      `json:"EndTime"`
 	Suspended bool        `json:"Suspended"`
 	Message   string      `json:"Message"`
+	CountyNo  []int       `json:"CountyNo"`
 }
 
 type tfvResponse struct {
@@ -29,9 +37,7 @@ type tfvResponse struct {
 				Deleted   bool           `json:"Deleted"`
 				Deviation []tfvDeviation `json:"Deviation"`
 			} `json:"Situation"`
-			Info struct {
-				LastChangeID string `json:"LASTCHANGEID"`
-			} `json:"INFO"`
+			Info trafikverket.Info `json:"INFO"`
 		} `json:"RESULT"`
 	} `json:"RESPONSE"`
 }
@@ -1,57 +1,28 @@
 package roadaccidents
 
 import (
-	"context"
-	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/diwise/context-broker/pkg/datamodels/fiware"
-	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
-	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
 )
 
-func (ts *roadAccidentSvc) publishRoadAccidentToContextBroker(ctx context.Context, dev tfvDeviation, deleted bool) error {
-	var err error
-	ctx, span := tracer.Start(ctx, "publish-to-broker")
-	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
-
+func newRoadAccidentEntity(dev tfvDeviation, deleted bool) (publisher.Entity, error) {
 	attributes, err := convertRoadAccidentToFiwareEntity(dev, deleted)
 	if err != nil {
-		err = fmt.Errorf("failed to create attribute for fiware entity: %s", err.Error())
-		return err
+		return publisher.Entity{}, fmt.Errorf("failed to create attribute for fiware entity: %s", err.Error())
 	}
 
-	fragment, _ := entities.NewFragment(attributes...)
-	entityID := fiware.RoadAccidentIDPrefix + "se:trafikverket:api:deviation:" + dev.Id
-
-	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
-
-	_, err = ts.ctxBroker.MergeEntity(ctx, entityID, fragment, headers)
-	if err != nil {
-		if !errors.Is(err, ngsierrors.ErrNotFound) {
-			err = fmt.Errorf("failed to merge entity: %s", err.Error())
-			return err
-		}
-
-		entity, err := entities.New(entityID, fiware.RoadAccidentTypeName, attributes...)
-		if err != nil {
-			err = fmt.Errorf("entities.New failed: %s", err.Error())
-			return err
-		}
-
-		_, err = ts.ctxBroker.CreateEntity(ctx, entity, headers)
-		if err != nil {
-			err = fmt.Errorf("failed to post road accident to context broker: %s", err.Error())
-			return err
-		}
-	}
-
-	return nil
+	return publisher.Entity{
+		ID:         fiware.RoadAccidentIDPrefix + "se:trafikverket:api:deviation:" + dev.Id,
+		Type:       fiware.RoadAccidentTypeName,
+		Attributes: attributes,
+		Counties:   publisher.CountyNumbers(dev.CountyNo...),
+	}, nil
 }
 
 func convertRoadAccidentToFiwareEntity(ra tfvDeviation, deleted bool) ([]entities.EntityDecoratorFunc, error) {
@@ -66,9 +37,13 @@ func convertRoadAccidentToFiwareEntity(ra tfvDeviation, deleted bool) ([]entitie
 		decorators.Status(status[deleted]),
 	)
 
-	if ra.Geometry.Point.WGS84 != "" {
-		lat, lon := getLocationFromString(ra.Geometry.Point.WGS84)
-		attributes = append(attributes, decorators.Location(lat, lon))
+	location, err := getLocation(ra.Geometry)
+	if err != nil {
+		return nil, err
+	}
+
+	if location != nil {
+		attributes = append(attributes, geometry.Location(location))
 	}
 
 	if ra.StartTime != "" {
@@ -80,13 +55,13 @@ func convertRoadAccidentToFiwareEntity(ra tfvDeviation, deleted bool) ([]entitie
 	return attributes, nil
 }
 
-func getLocationFromString(location string) (latitude float64, longitude float64) {
-	position := location[7 : len(location)-1]
-
-	Longitude := strings.Split(position, " ")[0]
-	newLong, _ := strconv.ParseFloat(Longitude, 32)
-	Latitude := strings.Split(position, " ")[1]
-	newLat, _ := strconv.ParseFloat(Latitude, 32)
+// getLocation prefers the line geometry of a deviation, that covers the affected road segment, over its point
+func getLocation(g tfvGeometry) (geometry.Geometry, error) {
+	for _, wkt := range []string{g.Line.WGS84, g.Point.WGS84} {
+		if wkt != "" {
+			return geometry.Parse(wkt)
+		}
+	}
 
-	return newLat, newLong
+	return nil, nil
 }
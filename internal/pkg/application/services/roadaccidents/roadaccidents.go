@@ -6,111 +6,193 @@ import (
 	"errors"
 	"time"
 
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
 	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
 	"go.opentelemetry.io/otel"
 )
 
-var ErrAlreadyExists = errors.New("already exists")
-
 type RoadAccidentSvc interface {
 	services.Starter
 }
 
 type roadAccidentSvc struct {
-	authKey    string
-	tfvURL     string
-	countyCode string
+	name     string
+	tfv      trafikverket.Client
+	counties []string
+	filters  []trafikverket.Filter
 
-	interval time.Duration
+	interval    time.Duration
+	streaming   bool
+	checkpoints checkpoint.Store
+	registry    *services.Registry
 
-	ctxBroker client.ContextBrokerClient
+	publisher publisher.Publisher
 }
 
 var tracer = otel.Tracer("roadaccidents")
 
-func NewService(_ context.Context, authKey, tfvURL, countyCode string, ctxBroker client.ContextBrokerClient) RoadAccidentSvc {
-	return &roadAccidentSvc{
-		authKey:    authKey,
-		tfvURL:     tfvURL,
-		countyCode: countyCode,
-		interval:   30 * time.Second,
-		ctxBroker:  ctxBroker,
+func NewService(_ context.Context, authKey, tfvURL, countyCode string, ctxBroker client.ContextBrokerClient, options ...func(*roadAccidentSvc)) RoadAccidentSvc {
+	ras := &roadAccidentSvc{
+		tfv:       trafikverket.NewClient(authKey, tfvURL),
+		name:      "roadaccidents",
+		interval:  30 * time.Second,
+		publisher: publisher.NewPublisher(ctxBroker),
+	}
+
+	if countyCode != "" {
+		ras.counties = []string{countyCode}
+	}
+
+	for _, option := range options {
+		option(ras)
+	}
+
+	return ras
+}
+
+// Filters adds filter expressions that are combined with the default filters when querying for road accidents
+func Filters(filters ...trafikverket.Filter) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.filters = append(ras.filters, filters...)
+	}
+}
+
+// Publisher replaces the default publisher, that merges one entity at a time into the context broker
+func Publisher(p publisher.Publisher) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.publisher = p
+	}
+}
+
+// Counties replaces the county code with the numbers of one or more counties to ingest road accidents from
+func Counties(codes ...string) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.counties = codes
+	}
+}
+
+// Name replaces the default name, roadaccidents, of the service so that several instances can be told apart
+func Name(name string) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.name = name
+	}
+}
+
+// Interval replaces the default interval of 30 seconds between polls for road accidents
+func Interval(interval time.Duration) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.interval = interval
+	}
+}
+
+// Streaming makes the service subscribe to a stream of changes instead of polling every interval
+func Streaming(enabled bool) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.streaming = enabled
+	}
+}
+
+// Checkpoints makes the service resume from, and record, the last published change id in store
+func Checkpoints(store checkpoint.Store) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.checkpoints = store
+	}
+}
+
+// Registry makes the service report its status to registry, and pause polling while the Trafikverket API is unavailable
+func Registry(registry *services.Registry) func(*roadAccidentSvc) {
+	return func(ras *roadAccidentSvc) {
+		ras.registry = registry
 	}
 }
 
 func (ras *roadAccidentSvc) Start(ctx context.Context) (chan struct{}, error) {
+	options := []func(*services.Poller){}
 
-	done := make(chan struct{})
-
-	go func() {
-		var err error
-		lastChangeID := "0"
-
-		tmr := time.NewTicker(ras.interval)
-
-		defer func() {
-			tmr.Stop()
-			done <- struct{}{}
-		}()
-
-		for {
-			select {
-			case <-tmr.C:
-				{
-					lastChangeID, err = ras.getAndPublishRoadAccidents(ctx, lastChangeID)
-					if err != nil {
-						logger := logging.GetFromContext(ctx)
-						logger.Error("failed to get and publish road accidents", "err", err.Error())
-					}
-				}
-			case <-ctx.Done():
-				{
-					return
-				}
-			}
-		}
-	}()
+	if ras.streaming {
+		options = append(options, services.Streaming(ras.tfv, ras.publishRoadAccidents))
+	}
+
+	if ras.checkpoints != nil {
+		key := ras.name + ":" + ras.newQuery("").Fingerprint()
+		options = append(options, services.Checkpoints(ras.checkpoints, key))
+	}
 
-	return done, nil
+	if ras.registry != nil {
+		options = append(options, services.Register(ras.registry))
+	}
+
+	return services.NewPoller(ras.name, ras.interval, ras.getAndPublishRoadAccidents, options...).Start(ctx)
 }
 
-func (ras *roadAccidentSvc) getAndPublishRoadAccidents(ctx context.Context, lastChangeID string) (string, error) {
+func (ras *roadAccidentSvc) getAndPublishRoadAccidents(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
 	var err error
 	ctx, span := tracer.Start(ctx, "get-and-publish")
 	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-	_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
-
 	resp, err := ras.getRoadAccidentsFromTFV(ctx, lastChangeID)
 	if err != nil {
-		return lastChangeID, err
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	info, err := ras.publishRoadAccidents(ctx, resp)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
 	}
 
+	return info, nil
+}
+
+// publishRoadAccidents publishes the road accidents in a response, or a streamed event, from the Trafikverket API
+func (ras *roadAccidentSvc) publishRoadAccidents(ctx context.Context, resp []byte) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "publish-road-accidents")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
 	logger.Debug("received response", "body", string(resp))
 
 	tfvResp := &tfvResponse{}
 	err = json.Unmarshal(resp, tfvResp)
 	if err != nil {
-		return lastChangeID, err
+		return trafikverket.Info{}, err
 	}
 
+	if len(tfvResp.Response.Result) == 0 {
+		err = errors.New("response contained no result")
+		return trafikverket.Info{}, err
+	}
+
+	ingestion := services.NewIngestion(ras.name)
+	batch := services.NewBatch(ingestion)
+
 	for _, sitch := range tfvResp.Response.Result[0].Situation {
+		ingestion.Fetched(ctx, "Deviation", len(sitch.Deviation))
+
 		for _, dev := range sitch.Deviation {
 			if dev.IconId == DeviationTypeRoadAccident {
-				err = ras.publishRoadAccidentToContextBroker(ctx, dev, sitch.Deleted)
-				if err != nil && !errors.Is(err, ErrAlreadyExists) {
-					logger.Error("failed to publish road accident", "id", dev.Id, "err", err.Error())
-					continue
-				}
+				batch.Convert(ctx, fiware.RoadAccidentTypeName, func() (publisher.Entity, error) {
+					return newRoadAccidentEntity(dev, sitch.Deleted)
+				}, "id", dev.Id)
 			} else {
 				logger.Info("ignoring deviation", "deviationtype", dev.IconId)
+				ingestion.Skipped(ctx, "Deviation", 1)
 			}
 		}
 	}
 
-	return tfvResp.Response.Result[0].Info.LastChangeID, nil
+	_, err = batch.Publish(ctx, ras.publisher)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	return tfvResp.Response.Result[0].Info, nil
 }
@@ -28,20 +28,11 @@ func TestPublishingRoadAccidentsToContextBroker(t *testing.T) {
 	is, cb, ts, ms := setupMockRoadAccident(t, 0, "")
 	defer ms.Close()
 
-	dev := tfvDeviation{
-		Id:     "id",
-		IconId: "roadAccident",
-		Geometry: tfvGeometry{
-			Point: tfvPoint{
-				WGS84: "POINT (13.0958767 55.9722252)",
-			},
-		},
-		Message:   "this is not a drill",
-		StartTime: "2022-04-21T19:37:57.000+02:00",
-		EndTime:   "2022-04-21T20:45:00.000+02:00",
-	}
-
-	_ = ts.publishRoadAccidentToContextBroker(context.Background(), dev, false)
+	_, err := ts.publishRoadAccidents(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"Situation":[{"Deleted":false,"Deviation":[
+		{"Id":"id","IconId":"roadAccident","Geometry":{"Point":{"WGS84":"POINT (13.0958767 55.9722252)"}},
+		 "Message":"this is not a drill","StartTime":"2022-04-21T19:37:57.000+02:00","EndTime":"2022-04-21T20:45:00.000+02:00"}
+	]}],"INFO":{"LASTCHANGEID":"7426311386101186961"}}]}}`))
+	is.NoErr(err)
 
 	is.Equal(len(cb.MergeEntityCalls()), 1)
 	is.Equal(cb.MergeEntityCalls()[0].EntityID, "urn:ngsi-ld:RoadAccident:se:trafikverket:api:deviation:id")
@@ -58,9 +49,24 @@ func TestThatLastChangeIDStoresCorrectly(t *testing.T) {
 	is, _, ts, ms := setupMockRoadAccident(t, http.StatusOK, tfvResponseJSON)
 	defer ms.Close()
 
-	lastChangeID, err := ts.getAndPublishRoadAccidents(context.Background(), "0")
+	info, err := ts.getAndPublishRoadAccidents(context.Background(), "0")
 	is.NoErr(err)
-	is.Equal(lastChangeID, "7426311386101186961")
+	is.Equal(info.LastChangeID, "7426311386101186961")
+}
+
+func TestThatInvalidGeometriesDoNotStopTheFeed(t *testing.T) {
+	is, cb, ts, ms := setupMockRoadAccident(t, 0, "")
+	defer ms.Close()
+
+	info, err := ts.publishRoadAccidents(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"Situation":[{"Deleted":false,"Deviation":[
+		{"Id":"SE_STA_TRISSID_1_1","IconId":"roadAccident","Geometry":{"Line":{"WGS84":"LINESTRING (18.45 63.28, 18.46"}}},
+		{"Id":"SE_STA_TRISSID_1_2","IconId":"roadAccident","Geometry":{"Point":{"WGS84":"POINT (18.4573116 63.2837563)"}}}
+	]}],"INFO":{"LASTCHANGEID":"7426311386101186961"}}]}}`))
+
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426311386101186961") // a geometry that can not be parsed should not hold back the change id
+	is.Equal(len(cb.MergeEntityCalls()), 1)
+	is.Equal(cb.MergeEntityCalls()[0].EntityID, "urn:ngsi-ld:RoadAccident:se:trafikverket:api:deviation:SE_STA_TRISSID_1_2")
 }
 
 func TestThatIfSituationIsDeletedStatusAttributeChanges(t *testing.T) {
@@ -70,20 +76,10 @@ func TestThatIfSituationIsDeletedStatusAttributeChanges(t *testing.T) {
 	_, err := ts.getAndPublishRoadAccidents(context.Background(), "0")
 	is.NoErr(err)
 
-	dev := tfvDeviation{
-		Id:     "SE_STA_TRISSID_1_6923722",
-		IconId: "roadAccident",
-		Geometry: tfvGeometry{
-			Point: tfvPoint{
-				WGS84: "POINT (13.0958767 55.9722252)",
-			},
-		},
-		StartTime: "2022-04-21T19:37:57.000+02:00",
-		EndTime:   "2022-04-21T20:45:00.000+02:00",
-	}
-
-	const IsDeleted bool = true
-	err = ts.publishRoadAccidentToContextBroker(context.Background(), dev, IsDeleted)
+	_, err = ts.publishRoadAccidents(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"Situation":[{"Deleted":true,"Deviation":[
+		{"Id":"SE_STA_TRISSID_1_6923722","IconId":"roadAccident","Geometry":{"Point":{"WGS84":"POINT (13.0958767 55.9722252)"}},
+		 "StartTime":"2022-04-21T19:37:57.000+02:00","EndTime":"2022-04-21T20:45:00.000+02:00"}
+	]}],"INFO":{"LASTCHANGEID":"7426311386101186962"}}]}}`))
 
 	is.NoErr(err)
 	is.Equal(len(cb.MergeEntityCalls()), 2) // this is 2 because the first publishing of a road accident will also initially trigger the mergeentity function, before moving on to create
@@ -0,0 +1,59 @@
+package roadconditions
+
+import (
+	"context"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+)
+
+func (rcs *roadConditionSvc) getRoadConditionsFromTFV(ctx context.Context, lastChangeID string) ([]byte, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-road-conditions")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	body, err := rcs.tfv.Query(ctx, rcs.newQuery(lastChangeID))
+	return body, err
+}
+
+func (rcs *roadConditionSvc) newQuery(lastChangeID string) trafikverket.Query {
+	filters := []trafikverket.Filter{}
+
+	if len(rcs.counties) == 1 {
+		filters = append(filters, trafikverket.Eq("CountyNo", rcs.counties[0]))
+	} else if len(rcs.counties) > 1 {
+		filters = append(filters, trafikverket.In("CountyNo", rcs.counties...))
+	}
+
+	filters = append(filters, rcs.filters...)
+
+	options := []trafikverket.QueryOption{
+		trafikverket.Namespace("road.trafficinfo"),
+		trafikverket.ChangeID(lastChangeID),
+		trafikverket.IncludeDeletedObjects(),
+		trafikverket.Where(filters...),
+		trafikverket.Include(
+			"Id",
+			"Deleted",
+			"ConditionCode",
+			"ConditionText",
+			"ConditionInfo",
+			"Warning",
+			"Measurement",
+			"Cause",
+			"LocationText",
+			"RoadNumber",
+			"Geometry.WGS84",
+			"StartTime",
+			"EndTime",
+			"ModifiedTime",
+			"CountyNo",
+		),
+	}
+
+	if rcs.streaming {
+		options = append(options, trafikverket.SSEURL())
+	}
+
+	return trafikverket.NewQuery("RoadCondition", "1.2", options...)
+}
@@ -0,0 +1,34 @@
+package roadconditions
+
+import "github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+
+type tfvGeometry struct {
+	WGS84 string `json:"WGS84"`
+}
+
+type tfvRoadCondition struct {
+	Id            string      `json:"Id"`
+	Deleted       bool        `json:"Deleted"`
+	ConditionCode int         `json:"ConditionCode"`
+	ConditionText string      `json:"ConditionText"`
+	ConditionInfo []string    `json:"ConditionInfo"`
+	Warning       []string    `json:"Warning"`
+	Measurement   []string    `json:"Measurement"`
+	Cause         []string    `json:"Cause"`
+	LocationText  string      `json:"LocationText"`
+	RoadNumber    string      `json:"RoadNumber"`
+	Geometry      tfvGeometry `json:"Geometry"`
+	StartTime     string      `json:"StartTime"`
+	EndTime       string      `json:"EndTime"`
+	ModifiedTime  string      `json:"ModifiedTime"`
+	CountyNo      []int       `json:"CountyNo"`
+}
+
+type tfvResponse struct {
+	Response struct {
+		Result []struct {
+			RoadCondition []tfvRoadCondition `json:"RoadCondition"`
+			Info          trafikverket.Info  `json:"INFO"`
+		} `json:"RESULT"`
+	} `json:"RESPONSE"`
+}
@@ -0,0 +1,96 @@
+package roadconditions
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+)
+
+const (
+	//RoadConditionTypeName is a type name constant for RoadCondition
+	RoadConditionTypeName string = "RoadCondition"
+	//RoadConditionIDPrefix ...
+	RoadConditionIDPrefix string = "urn:ngsi-ld:" + RoadConditionTypeName + ":"
+)
+
+func newRoadConditionEntity(rc tfvRoadCondition) (publisher.Entity, error) {
+	attributes, err := convertRoadConditionToFiwareEntity(rc)
+	if err != nil {
+		return publisher.Entity{}, fmt.Errorf("failed to create attribute for fiware entity: %s", err.Error())
+	}
+
+	return publisher.Entity{
+		ID:         RoadConditionIDPrefix + "se:trafikverket:api:roadcondition:" + rc.Id,
+		Type:       RoadConditionTypeName,
+		Attributes: attributes,
+		Counties:   publisher.CountyNumbers(rc.CountyNo...),
+	}, nil
+}
+
+func convertRoadConditionToFiwareEntity(rc tfvRoadCondition) ([]entities.EntityDecoratorFunc, error) {
+	status := map[bool]string{
+		true:  "inactive",
+		false: "active",
+	}
+
+	attributes := append(
+		make([]entities.EntityDecoratorFunc, 0, 14),
+		decorators.Status(status[rc.Deleted]),
+		decorators.Number("conditionCode", float64(rc.ConditionCode)),
+	)
+
+	if rc.ConditionText != "" {
+		attributes = append(attributes, decorators.Text("conditionText", rc.ConditionText))
+	}
+
+	if rc.LocationText != "" {
+		attributes = append(attributes, decorators.Description(rc.LocationText))
+	}
+
+	if rc.RoadNumber != "" {
+		attributes = append(attributes, decorators.Text("roadNumber", rc.RoadNumber))
+	}
+
+	textLists := map[string][]string{
+		"conditionInfo": rc.ConditionInfo,
+		"warnings":      rc.Warning,
+		"measures":      rc.Measurement,
+		"causes":        rc.Cause,
+	}
+
+	for name, values := range textLists {
+		if len(values) > 0 {
+			attributes = append(attributes, decorators.TextList(name, values))
+		}
+	}
+
+	if rc.Geometry.WGS84 != "" {
+		location, err := geometry.Parse(rc.Geometry.WGS84)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, geometry.Location(location))
+	}
+
+	timestamps := map[string]string{
+		"validFrom":    rc.StartTime,
+		"validTo":      rc.EndTime,
+		"dateModified": rc.ModifiedTime,
+	}
+
+	for name, value := range timestamps {
+		if value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %s", name, err.Error())
+			}
+			attributes = append(attributes, decorators.DateTime(name, t.UTC().Format(time.RFC3339)))
+		}
+	}
+
+	return attributes, nil
+}
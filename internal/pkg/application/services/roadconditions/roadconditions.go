@@ -0,0 +1,194 @@
+package roadconditions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+type RoadConditionSvc interface {
+	services.Starter
+}
+
+type roadConditionSvc struct {
+	name     string
+	tfv      trafikverket.Client
+	counties []string
+	filters  []trafikverket.Filter
+
+	interval    time.Duration
+	streaming   bool
+	checkpoints checkpoint.Store
+	registry    *services.Registry
+
+	publisher publisher.Publisher
+}
+
+var tracer = otel.Tracer("roadconditions")
+
+func NewService(_ context.Context, authKey, tfvURL, countyCode string, ctxBroker client.ContextBrokerClient, options ...func(*roadConditionSvc)) RoadConditionSvc {
+	rcs := &roadConditionSvc{
+		tfv:       trafikverket.NewClient(authKey, tfvURL),
+		name:      "roadconditions",
+		interval:  30 * time.Second,
+		publisher: publisher.NewPublisher(ctxBroker),
+	}
+
+	if countyCode != "" {
+		rcs.counties = []string{countyCode}
+	}
+
+	for _, option := range options {
+		option(rcs)
+	}
+
+	return rcs
+}
+
+// Filters adds filter expressions that are combined with the county filter when querying for road conditions
+func Filters(filters ...trafikverket.Filter) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.filters = append(rcs.filters, filters...)
+	}
+}
+
+// Publisher replaces the default publisher, that merges one entity at a time into the context broker
+func Publisher(p publisher.Publisher) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.publisher = p
+	}
+}
+
+// Counties replaces the county code with the numbers of one or more counties to ingest road conditions from
+func Counties(codes ...string) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.counties = codes
+	}
+}
+
+// Name replaces the default name, roadconditions, of the service so that several instances can be told apart
+func Name(name string) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.name = name
+	}
+}
+
+// Interval replaces the default interval of 30 seconds between polls for road conditions
+func Interval(interval time.Duration) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.interval = interval
+	}
+}
+
+// Streaming makes the service subscribe to a stream of changes instead of polling every interval
+func Streaming(enabled bool) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.streaming = enabled
+	}
+}
+
+// Checkpoints makes the service resume from, and record, the last published change id in store
+func Checkpoints(store checkpoint.Store) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.checkpoints = store
+	}
+}
+
+// Registry makes the service report its status to registry, and pause polling while the Trafikverket API is unavailable
+func Registry(registry *services.Registry) func(*roadConditionSvc) {
+	return func(rcs *roadConditionSvc) {
+		rcs.registry = registry
+	}
+}
+
+func (rcs *roadConditionSvc) Start(ctx context.Context) (chan struct{}, error) {
+	options := []func(*services.Poller){}
+
+	if rcs.streaming {
+		options = append(options, services.Streaming(rcs.tfv, rcs.publishRoadConditions))
+	}
+
+	if rcs.checkpoints != nil {
+		key := rcs.name + ":" + rcs.newQuery("").Fingerprint()
+		options = append(options, services.Checkpoints(rcs.checkpoints, key))
+	}
+
+	if rcs.registry != nil {
+		options = append(options, services.Register(rcs.registry))
+	}
+
+	return services.NewPoller(rcs.name, rcs.interval, rcs.getAndPublishRoadConditions, options...).Start(ctx)
+}
+
+func (rcs *roadConditionSvc) getAndPublishRoadConditions(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-and-publish")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	resp, err := rcs.getRoadConditionsFromTFV(ctx, lastChangeID)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	info, err := rcs.publishRoadConditions(ctx, resp)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	return info, nil
+}
+
+// publishRoadConditions publishes the road conditions in a response, or a streamed event, from the Trafikverket API
+func (rcs *roadConditionSvc) publishRoadConditions(ctx context.Context, resp []byte) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "publish-road-conditions")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+	logger.Debug("received response", "body", string(resp))
+
+	tfvResp := &tfvResponse{}
+	err = json.Unmarshal(resp, tfvResp)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	if len(tfvResp.Response.Result) == 0 {
+		err = errors.New("response contained no result")
+		return trafikverket.Info{}, err
+	}
+
+	ingestion := services.NewIngestion(rcs.name)
+	ingestion.Fetched(ctx, "RoadCondition", len(tfvResp.Response.Result[0].RoadCondition))
+
+	batch := services.NewBatch(ingestion)
+
+	for _, rc := range tfvResp.Response.Result[0].RoadCondition {
+		if modified, err := time.Parse(time.RFC3339, rc.ModifiedTime); err == nil {
+			ingestion.Observed(modified)
+		}
+
+		batch.Convert(ctx, RoadConditionTypeName, func() (publisher.Entity, error) {
+			return newRoadConditionEntity(rc)
+		}, "id", rc.Id)
+	}
+
+	_, err = batch.Publish(ctx, rcs.publisher)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	return tfvResp.Response.Result[0].Info, nil
+}
@@ -0,0 +1,99 @@
+package roadconditions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	test "github.com/diwise/context-broker/pkg/test"
+	. "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/expects"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestRetrievingRoadConditionsFromTFV(t *testing.T) {
+	is, _, rcs, ms := setupMockRoadCondition(t, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	_, err := rcs.getRoadConditionsFromTFV(context.Background(), "0")
+	is.NoErr(err)
+}
+
+func TestThatRoadConditionsArePublished(t *testing.T) {
+	is, cb, rcs, ms := setupMockRoadCondition(t, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	info, err := rcs.getAndPublishRoadConditions(context.Background(), "0")
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426311386101186962")
+
+	is.Equal(len(cb.MergeEntityCalls()), 2)
+	is.Equal(len(cb.CreateEntityCalls()), 2)
+	is.Equal(cb.CreateEntityCalls()[0].Entity.ID(), "urn:ngsi-ld:RoadCondition:se:trafikverket:api:roadcondition:SE_STA_VVIS_2200100_1")
+	is.NoErr(entities.ValidateFragmentAttributes(
+		cb.CreateEntityCalls()[0].Entity,
+		map[string]any{
+			"conditionCode": 4,
+			"conditionText": "Is- och snövägbana",
+			"status":        "active",
+			"validFrom":     "2024-12-03T05:00:00Z",
+		},
+	))
+	is.NoErr(entities.ValidateFragmentAttributes(
+		cb.MergeEntityCalls()[1].Fragment,
+		map[string]any{"status": "inactive"},
+	))
+}
+
+func TestThatRoadConditionsArePublishedAsLineStrings(t *testing.T) {
+	is := is.New(t)
+
+	attributes, err := convertRoadConditionToFiwareEntity(tfvRoadCondition{
+		Id:       "SE_STA_VVIS_2200100_1",
+		Geometry: tfvGeometry{WGS84: "LINESTRING (17.3058 62.3908, 17.3121 62.3953)"},
+	})
+	is.NoErr(err)
+
+	e, _ := entities.New("urn:ngsi-ld:RoadCondition:1", RoadConditionTypeName, attributes...)
+	b, _ := json.Marshal(e)
+	is.True(strings.Contains(string(b), `{"type":"LineString","coordinates":[[17.3058,62.3908],[17.3121,62.3953]]}`))
+
+	_, err = convertRoadConditionToFiwareEntity(tfvRoadCondition{Geometry: tfvGeometry{WGS84: "LINESTRING (17.3058)"}})
+	is.True(err != nil) // expected an error but got none
+}
+
+func setupMockRoadCondition(t *testing.T, tfvCode int, tfvBody string) (*is.I, *test.ContextBrokerClientMock, *roadConditionSvc, MockService) {
+	is := is.New(t)
+	tfvMock := NewMockServiceThat(
+		Expects(is, expects.RequestBodyContaining(`objecttype="RoadCondition"`)),
+		Returns(
+			response.Code(tfvCode),
+			response.Body([]byte(tfvBody)),
+		),
+	)
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return nil, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, ngsierrors.ErrNotFound
+		},
+	}
+
+	rcs := NewService(context.Background(), "", tfvMock.URL(), "22", ctxBroker)
+
+	return is, ctxBroker, rcs.(*roadConditionSvc), tfvMock
+}
+
+const tfvResponseJSON string = `{"RESPONSE":{"RESULT":[{"RoadCondition":[
+	{"Id":"SE_STA_VVIS_2200100_1","Deleted":false,"ConditionCode":4,"ConditionText":"Is- och snövägbana","ConditionInfo":["Snöfall"],"Warning":["Halka"],"Measurement":["Saltning"],"LocationText":"Väg 86 Sundsvall - Indal","RoadNumber":"Väg 86","Geometry":{"WGS84":"LINESTRING (17.3058 62.3908, 17.3121 62.3953)"},"StartTime":"2024-12-03T06:00:00.000+01:00","ModifiedTime":"2024-12-03T06:05:00.000+01:00"},
+	{"Id":"SE_STA_VVIS_2200100_2","Deleted":true,"ConditionCode":1,"Geometry":{"WGS84":"LINESTRING (17.3121 62.3953, 17.3200 62.4000)"},"StartTime":"2024-12-02T06:00:00.000+01:00","EndTime":"2024-12-03T06:00:00.000+01:00"}
+],"INFO":{"LASTCHANGEID":"7426311386101186962"}}]}}`
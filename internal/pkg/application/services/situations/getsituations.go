@@ -0,0 +1,63 @@
+package situations
+
+import (
+	"context"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+)
+
+func (ss *situationSvc) getSituationsFromTFV(ctx context.Context, lastChangeID string) ([]byte, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-traffic-information")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	body, err := ss.tfv.Query(ctx, ss.newQuery(lastChangeID))
+	return body, err
+}
+
+func (ss *situationSvc) newQuery(lastChangeID string) trafikverket.Query {
+	filters := []trafikverket.Filter{
+		trafikverket.In("Deviation.MessageType", ss.messageTypes...),
+	}
+
+	if len(ss.counties) == 1 {
+		filters = append(filters, trafikverket.Eq("Deviation.CountyNo", ss.counties[0]))
+	} else if len(ss.counties) > 1 {
+		filters = append(filters, trafikverket.In("Deviation.CountyNo", ss.counties...))
+	}
+
+	filters = append(filters, ss.filters...)
+
+	options := []trafikverket.QueryOption{
+		trafikverket.Namespace("road.trafficinfo"),
+		trafikverket.ChangeID(lastChangeID),
+		trafikverket.IncludeDeletedObjects(),
+		trafikverket.Where(filters...),
+		trafikverket.Include(
+			"Deviation.Id",
+			"Deviation.MessageType",
+			"Deviation.MessageCode",
+			"Deviation.IconId",
+			"Deviation.Header",
+			"Deviation.Message",
+			"Deviation.LocationDescriptor",
+			"Deviation.RoadNumber",
+			"Deviation.SeverityCode",
+			"Deviation.SeverityText",
+			"Deviation.StartTime",
+			"Deviation.EndTime",
+			"Deviation.Suspended",
+			"Deviation.Geometry.Point.WGS84",
+			"Deviation.Geometry.Line.WGS84",
+			"Deviation.CountyNo",
+			"Deleted",
+		),
+	}
+
+	if ss.streaming {
+		options = append(options, trafikverket.SSEURL())
+	}
+
+	return trafikverket.NewQuery("Situation", "1.6", options...)
+}
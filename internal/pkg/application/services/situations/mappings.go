@@ -0,0 +1,253 @@
+package situations
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+)
+
+const (
+	//RoadWorkTypeName is a type name constant for RoadWork
+	RoadWorkTypeName string = "RoadWork"
+	//RoadWorkIDPrefix ...
+	RoadWorkIDPrefix string = "urn:ngsi-ld:" + RoadWorkTypeName + ":"
+
+	//TrafficRestrictionTypeName is a type name constant for TrafficRestriction
+	TrafficRestrictionTypeName string = "TrafficRestriction"
+	//TrafficRestrictionIDPrefix ...
+	TrafficRestrictionIDPrefix string = "urn:ngsi-ld:" + TrafficRestrictionTypeName + ":"
+
+	//AlertTypeName is a type name constant for Alert
+	AlertTypeName string = "Alert"
+	//AlertIDPrefix ...
+	AlertIDPrefix string = "urn:ngsi-ld:" + AlertTypeName + ":"
+)
+
+// mapping describes how deviations of a certain message type are published to the context broker
+type mapping struct {
+	typeName string
+	idPrefix string
+	// category separates the ids of message types that are published as the same entity type
+	category string
+	convert  func(dev tfvDeviation, deleted bool) ([]entities.EntityDecoratorFunc, error)
+}
+
+func (m mapping) entityID(dev tfvDeviation) string {
+	return m.idPrefix + "se:trafikverket:api:" + m.category + ":" + dev.Id
+}
+
+// mappings contains the supported values of Deviation.MessageType
+var mappings = map[string]mapping{
+	"Olycka": {
+		typeName: fiware.RoadAccidentTypeName,
+		idPrefix: fiware.RoadAccidentIDPrefix,
+		category: "deviation",
+		convert:  convertRoadAccident,
+	},
+	"Vägarbete": {
+		typeName: RoadWorkTypeName,
+		idPrefix: RoadWorkIDPrefix,
+		category: "deviation",
+		convert:  convertRoadWork,
+	},
+	"Restriktion": {
+		typeName: TrafficRestrictionTypeName,
+		idPrefix: TrafficRestrictionIDPrefix,
+		category: "deviation",
+		convert:  convertTrafficRestriction,
+	},
+	"Hinder": {
+		typeName: AlertTypeName,
+		idPrefix: AlertIDPrefix,
+		category: "obstacle",
+		convert:  alertConverter("obstacle"),
+	},
+	"Färjor": {
+		typeName: AlertTypeName,
+		idPrefix: AlertIDPrefix,
+		category: "ferryDeviation",
+		convert:  alertConverter("ferryDeviation"),
+	},
+	"Viktig trafikinformation": {
+		typeName: AlertTypeName,
+		idPrefix: AlertIDPrefix,
+		category: "importantTrafficInformation",
+		convert:  alertConverter("importantTrafficInformation"),
+	},
+	"Trafikmeddelande": {
+		typeName: AlertTypeName,
+		idPrefix: AlertIDPrefix,
+		category: "trafficMessage",
+		convert:  alertConverter("trafficMessage"),
+	},
+}
+
+// SupportedMessageTypes returns the message types that can be mapped to Fiware entities, in sorted order
+func SupportedMessageTypes() []string {
+	return slices.Sorted(maps.Keys(mappings))
+}
+
+func convertRoadAccident(dev tfvDeviation, deleted bool) ([]entities.EntityDecoratorFunc, error) {
+	status := map[bool]string{
+		true:  "solved",
+		false: "onGoing",
+	}
+
+	attributes, err := commonAttributes(dev, status[deleted])
+	if err != nil {
+		return nil, err
+	}
+
+	if dev.StartTime != "" {
+		t, err := time.Parse(time.RFC3339, dev.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse accident date: %s", err.Error())
+		}
+		attributes = append(attributes, decorators.DateTime("accidentDate", t.UTC().Format(time.RFC3339)))
+	}
+
+	return attributes, nil
+}
+
+func convertRoadWork(dev tfvDeviation, deleted bool) ([]entities.EntityDecoratorFunc, error) {
+	status := map[bool]string{
+		true:  "finished",
+		false: "onGoing",
+	}
+
+	if dev.Suspended && !deleted {
+		return commonAttributes(dev, "suspended")
+	}
+
+	return commonAttributes(dev, status[deleted])
+}
+
+func convertTrafficRestriction(dev tfvDeviation, deleted bool) ([]entities.EntityDecoratorFunc, error) {
+	status := map[bool]string{
+		true:  "inactive",
+		false: "active",
+	}
+
+	attributes, err := commonAttributes(dev, status[deleted])
+	if err != nil {
+		return nil, err
+	}
+
+	if dev.MessageCode != "" {
+		attributes = append(attributes, decorators.Text("restrictionType", dev.MessageCode))
+	}
+
+	return attributes, nil
+}
+
+// alertConverter returns a converter for deviations that are published as traffic alerts with the given sub category
+func alertConverter(subCategory string) func(tfvDeviation, bool) ([]entities.EntityDecoratorFunc, error) {
+	return func(dev tfvDeviation, deleted bool) ([]entities.EntityDecoratorFunc, error) {
+		status := map[bool]string{
+			true:  "inactive",
+			false: "active",
+		}
+
+		attributes, err := commonAttributes(dev, status[deleted])
+		if err != nil {
+			return nil, err
+		}
+
+		attributes = append(attributes,
+			decorators.Text("category", "traffic"),
+			decorators.Text("subCategory", subCategory),
+		)
+
+		if severity, ok := alertSeverities[dev.SeverityCode]; ok {
+			attributes = append(attributes, decorators.Text("severity", severity))
+		}
+
+		return attributes, nil
+	}
+}
+
+// alertSeverities maps the severity codes used by Trafikverket to the severity levels of a Fiware Alert
+var alertSeverities = map[int]string{
+	1: "informational",
+	2: "low",
+	3: "medium",
+	4: "high",
+	5: "critical",
+}
+
+func commonAttributes(dev tfvDeviation, status string) ([]entities.EntityDecoratorFunc, error) {
+	attributes := append(
+		make([]entities.EntityDecoratorFunc, 0, 12),
+		decorators.Status(status),
+		decorators.Text("messageType", dev.MessageType),
+	)
+
+	if dev.Message != "" {
+		attributes = append(attributes, decorators.Description(dev.Message))
+	}
+
+	if dev.Header != "" {
+		attributes = append(attributes, decorators.Name(dev.Header))
+	}
+
+	if dev.MessageCode != "" {
+		attributes = append(attributes, decorators.Text("messageCode", dev.MessageCode))
+	}
+
+	if dev.LocationDescriptor != "" {
+		attributes = append(attributes, decorators.Text("locationDescriptor", dev.LocationDescriptor))
+	}
+
+	if dev.RoadNumber != "" {
+		attributes = append(attributes, decorators.Text("roadNumber", dev.RoadNumber))
+	}
+
+	if dev.SeverityText != "" {
+		attributes = append(attributes, decorators.Text("severityText", dev.SeverityText))
+	}
+
+	location, err := getLocation(dev.Geometry)
+	if err != nil {
+		return nil, err
+	}
+
+	if location != nil {
+		attributes = append(attributes, geometry.Location(location))
+	}
+
+	if dev.StartTime != "" {
+		t, err := time.Parse(time.RFC3339, dev.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse start time: %s", err.Error())
+		}
+		utcTime := t.UTC().Format(time.RFC3339)
+		attributes = append(attributes, decorators.DateCreated(utcTime), decorators.DateTime("validFrom", utcTime))
+	}
+
+	if dev.EndTime != "" {
+		t, err := time.Parse(time.RFC3339, dev.EndTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse end time: %s", err.Error())
+		}
+		attributes = append(attributes, decorators.DateTime("validTo", t.UTC().Format(time.RFC3339)))
+	}
+
+	return attributes, nil
+}
+
+// getLocation prefers the line geometry of a deviation, that covers the affected road segment, over its point
+func getLocation(g tfvGeometry) (geometry.Geometry, error) {
+	for _, wkt := range []string{g.Line.WGS84, g.Point.WGS84} {
+		if wkt != "" {
+			return geometry.Parse(wkt)
+		}
+	}
+
+	return nil, nil
+}
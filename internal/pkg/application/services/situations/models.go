@@ -0,0 +1,48 @@
+package situations
+
+import "github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+
+type tfvPoint struct {
+	WGS84 string `json:"WGS84"`
+}
+
+type tfvLine struct {
+	WGS84 string `json:"WGS84"`
+}
+
+type tfvGeometry struct {
+	Point tfvPoint `json:"Point"`
+	Line  tfvLine  `json:"Line"`
+}
+
+type tfvDeviation struct {
+	Id                 string      `json:"Id"`
+	MessageType        string      `json:"MessageType"`
+	MessageCode        string      `json:"MessageCode"`
+	IconId             string      `json:"IconId"`
+	Header             string      `json:"Header"`
+	Message            string      `json:"Message"`
+	LocationDescriptor string      `json:"LocationDescriptor"`
+	RoadNumber         string      `json:"RoadNumber"`
+	SeverityCode       int         `json:"SeverityCode"`
+	SeverityText       string      `json:"SeverityText"`
+	Geometry           tfvGeometry `json:"Geometry"`
+	StartTime          string      `json:"StartTime"`
+	EndTime            string      `json:"EndTime"`
+	Suspended          bool        `json:"Suspended"`
+	CountyNo           []int       `json:"CountyNo"`
+}
+
+type tfvSituation struct {
+	Deleted   bool           `json:"Deleted"`
+	Deviation []tfvDeviation `json:"Deviation"`
+}
+
+type tfvResponse struct {
+	Response struct {
+		Result []struct {
+			Situation []tfvSituation    `json:"Situation"`
+			Info      trafikverket.Info `json:"INFO"`
+		} `json:"RESULT"`
+	} `json:"RESPONSE"`
+}
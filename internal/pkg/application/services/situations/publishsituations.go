@@ -0,0 +1,26 @@
+package situations
+
+import (
+	"fmt"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+)
+
+func newDeviationEntity(dev tfvDeviation, deleted bool) (publisher.Entity, error) {
+	m, ok := mappings[dev.MessageType]
+	if !ok {
+		return publisher.Entity{}, fmt.Errorf("unsupported message type %q", dev.MessageType)
+	}
+
+	attributes, err := m.convert(dev, deleted)
+	if err != nil {
+		return publisher.Entity{}, fmt.Errorf("failed to create attribute for fiware entity: %s", err.Error())
+	}
+
+	return publisher.Entity{
+		ID:         m.entityID(dev),
+		Type:       m.typeName,
+		Attributes: attributes,
+		Counties:   publisher.CountyNumbers(dev.CountyNo...),
+	}, nil
+}
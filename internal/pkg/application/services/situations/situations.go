@@ -0,0 +1,223 @@
+package situations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+type SituationSvc interface {
+	services.Starter
+}
+
+type situationSvc struct {
+	name         string
+	tfv          trafikverket.Client
+	counties     []string
+	messageTypes []string
+	filters      []trafikverket.Filter
+
+	interval    time.Duration
+	streaming   bool
+	checkpoints checkpoint.Store
+	registry    *services.Registry
+
+	publisher publisher.Publisher
+}
+
+var tracer = otel.Tracer("situations")
+
+// NewService creates a service that publishes traffic situation deviations of the given message
+// types, such as "Vägarbete" or "Restriktion", to the context broker
+func NewService(_ context.Context, authKey, tfvURL, countyCode string, messageTypes []string, ctxBroker client.ContextBrokerClient, options ...func(*situationSvc)) SituationSvc {
+	ss := &situationSvc{
+		tfv:          trafikverket.NewClient(authKey, tfvURL),
+		messageTypes: messageTypes,
+		name:         "situations",
+		interval:     30 * time.Second,
+		publisher:    publisher.NewPublisher(ctxBroker),
+	}
+
+	if countyCode != "" {
+		ss.counties = []string{countyCode}
+	}
+
+	for _, option := range options {
+		option(ss)
+	}
+
+	return ss
+}
+
+// Filters adds filter expressions that are combined with the message type and county filters when querying for situations
+func Filters(filters ...trafikverket.Filter) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.filters = append(ss.filters, filters...)
+	}
+}
+
+// Publisher replaces the default publisher, that merges one entity at a time into the context broker
+func Publisher(p publisher.Publisher) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.publisher = p
+	}
+}
+
+// Counties replaces the county code with the numbers of one or more counties to ingest situations from
+func Counties(codes ...string) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.counties = codes
+	}
+}
+
+// Name replaces the default name, situations, of the service so that several instances can be told apart
+func Name(name string) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.name = name
+	}
+}
+
+// Interval replaces the default interval of 30 seconds between polls for situations
+func Interval(interval time.Duration) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.interval = interval
+	}
+}
+
+// Streaming makes the service subscribe to a stream of changes instead of polling every interval
+func Streaming(enabled bool) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.streaming = enabled
+	}
+}
+
+// Checkpoints makes the service resume from, and record, the last published change id in store
+func Checkpoints(store checkpoint.Store) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.checkpoints = store
+	}
+}
+
+// Registry makes the service report its status to registry, and pause polling while the Trafikverket API is unavailable
+func Registry(registry *services.Registry) func(*situationSvc) {
+	return func(ss *situationSvc) {
+		ss.registry = registry
+	}
+}
+
+func (ss *situationSvc) Start(ctx context.Context) (chan struct{}, error) {
+	if len(ss.messageTypes) == 0 {
+		return nil, errors.New("no message types configured")
+	}
+
+	for _, mt := range ss.messageTypes {
+		if _, ok := mappings[mt]; !ok {
+			return nil, fmt.Errorf("unsupported message type %q, expected one of %v", mt, SupportedMessageTypes())
+		}
+	}
+
+	options := []func(*services.Poller){}
+
+	if ss.streaming {
+		options = append(options, services.Streaming(ss.tfv, ss.publishSituations))
+	}
+
+	if ss.checkpoints != nil {
+		key := ss.name + ":" + ss.newQuery("").Fingerprint()
+		options = append(options, services.Checkpoints(ss.checkpoints, key))
+	}
+
+	if ss.registry != nil {
+		options = append(options, services.Register(ss.registry))
+	}
+
+	return services.NewPoller(ss.name, ss.interval, ss.getAndPublishSituations, options...).Start(ctx)
+}
+
+func (ss *situationSvc) getAndPublishSituations(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-and-publish")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	resp, err := ss.getSituationsFromTFV(ctx, lastChangeID)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	info, err := ss.publishSituations(ctx, resp)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	return info, nil
+}
+
+// publishSituations publishes the deviations in a response, or a streamed event, from the Trafikverket API
+func (ss *situationSvc) publishSituations(ctx context.Context, resp []byte) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "publish-situations")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+	logger.Debug("received response", "body", string(resp))
+
+	tfvResp := &tfvResponse{}
+	err = json.Unmarshal(resp, tfvResp)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	if len(tfvResp.Response.Result) == 0 {
+		err = errors.New("response contained no result")
+		return trafikverket.Info{}, err
+	}
+
+	ingestion := services.NewIngestion(ss.name)
+	batch := services.NewBatch(ingestion)
+
+	for _, s := range tfvResp.Response.Result[0].Situation {
+		ingestion.Fetched(ctx, "Deviation", len(s.Deviation))
+
+		for _, dev := range s.Deviation {
+			if !ss.accepts(dev.MessageType) {
+				// a situation may contain deviations of other types than the ones we asked for
+				logger.Debug("ignoring deviation", "id", dev.Id, "messagetype", dev.MessageType)
+				ingestion.Skipped(ctx, "Deviation", 1)
+				continue
+			}
+
+			batch.Convert(ctx, mappings[dev.MessageType].typeName, func() (publisher.Entity, error) {
+				return newDeviationEntity(dev, s.Deleted)
+			}, "id", dev.Id, "messagetype", dev.MessageType)
+		}
+	}
+
+	_, err = batch.Publish(ctx, ss.publisher)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	return tfvResp.Response.Result[0].Info, nil
+}
+
+func (ss *situationSvc) accepts(messageType string) bool {
+	for _, mt := range ss.messageTypes {
+		if mt == messageType {
+			return true
+		}
+	}
+	return false
+}
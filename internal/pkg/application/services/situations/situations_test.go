@@ -0,0 +1,161 @@
+package situations
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	test "github.com/diwise/context-broker/pkg/test"
+	. "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/expects"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestThatConfiguredMessageTypesAreQueried(t *testing.T) {
+	is, _, ss, ms := setupMockSituation(t, []string{"Vägarbete", "Restriktion"}, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	_, err := ss.getSituationsFromTFV(context.Background(), "0")
+	is.NoErr(err)
+}
+
+func TestThatSupportedMessageTypesAreSorted(t *testing.T) {
+	is := is.New(t)
+	is.Equal(SupportedMessageTypes(), []string{"Färjor", "Hinder", "Olycka", "Restriktion", "Trafikmeddelande", "Viktig trafikinformation", "Vägarbete"})
+}
+
+func TestThatDeviationsAreMappedByMessageType(t *testing.T) {
+	is, cb, ss, ms := setupMockSituation(t, []string{"Vägarbete", "Restriktion", "Hinder"}, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	info, err := ss.getAndPublishSituations(context.Background(), "0")
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426311386101186963")
+
+	is.Equal(len(cb.CreateEntityCalls()), 3) // the road accident should be ignored
+
+	roadWork := cb.CreateEntityCalls()[0].Entity
+	is.Equal(roadWork.ID(), "urn:ngsi-ld:RoadWork:se:trafikverket:api:deviation:SE_STA_TRISSID_1_100")
+	is.Equal(roadWork.Type(), "RoadWork")
+	is.NoErr(entities.ValidateFragmentAttributes(roadWork, map[string]any{
+		"status":    "onGoing",
+		"validFrom": "2024-10-16T08:00:00Z",
+		"validTo":   "2024-11-16T16:00:00Z",
+	}))
+
+	restriction := cb.CreateEntityCalls()[1].Entity
+	is.Equal(restriction.ID(), "urn:ngsi-ld:TrafficRestriction:se:trafikverket:api:deviation:SE_STA_TRISSID_2_100")
+	is.NoErr(entities.ValidateFragmentAttributes(restriction, map[string]any{
+		"restrictionType": "Viktbegränsning",
+	}))
+
+	obstacle := cb.CreateEntityCalls()[2].Entity
+	is.Equal(obstacle.ID(), "urn:ngsi-ld:Alert:se:trafikverket:api:obstacle:SE_STA_TRISSID_1_200")
+	is.NoErr(entities.ValidateFragmentAttributes(obstacle, map[string]any{
+		"status":      "inactive",
+		"category":    "traffic",
+		"subCategory": "obstacle",
+		"severity":    "high",
+	}))
+}
+
+func TestThatEveryMessageTypeHasItsOwnIDPrefix(t *testing.T) {
+	is, cb, ss, ms := setupMockSituation(t, SupportedMessageTypes(), 0, "")
+	defer ms.Close()
+
+	_, err := ss.publishSituations(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"Situation":[{"Deleted":false,"Deviation":[
+		{"Id":"SE_STA_TRISSID_1_1","MessageType":"Olycka","IconId":"roadAccident"},
+		{"Id":"SE_STA_TRISSID_1_2","MessageType":"Vägarbete"},
+		{"Id":"SE_STA_TRISSID_1_3","MessageType":"Restriktion"},
+		{"Id":"SE_STA_TRISSID_1_4","MessageType":"Hinder"},
+		{"Id":"SE_STA_TRISSID_1_5","MessageType":"Färjor"},
+		{"Id":"SE_STA_TRISSID_1_6","MessageType":"Viktig trafikinformation"},
+		{"Id":"SE_STA_TRISSID_1_7","MessageType":"Trafikmeddelande"}
+	]}],"INFO":{"LASTCHANGEID":"7426311386101186963"}}]}}`))
+	is.NoErr(err)
+
+	ids := []string{}
+	for _, call := range cb.CreateEntityCalls() {
+		ids = append(ids, call.Entity.ID())
+	}
+
+	is.Equal(ids, []string{
+		"urn:ngsi-ld:RoadAccident:se:trafikverket:api:deviation:SE_STA_TRISSID_1_1",
+		"urn:ngsi-ld:RoadWork:se:trafikverket:api:deviation:SE_STA_TRISSID_1_2",
+		"urn:ngsi-ld:TrafficRestriction:se:trafikverket:api:deviation:SE_STA_TRISSID_1_3",
+		"urn:ngsi-ld:Alert:se:trafikverket:api:obstacle:SE_STA_TRISSID_1_4",
+		"urn:ngsi-ld:Alert:se:trafikverket:api:ferryDeviation:SE_STA_TRISSID_1_5",
+		"urn:ngsi-ld:Alert:se:trafikverket:api:importantTrafficInformation:SE_STA_TRISSID_1_6",
+		"urn:ngsi-ld:Alert:se:trafikverket:api:trafficMessage:SE_STA_TRISSID_1_7",
+	})
+}
+
+func TestThatAnAccidentWithAnInvalidStartTimeIsNotConverted(t *testing.T) {
+	is := is.New(t)
+
+	_, err := convertRoadAccident(tfvDeviation{Id: "SE_STA_TRISSID_1_1", MessageType: "Olycka", StartTime: "yesterday"}, false)
+	is.True(err != nil) // expected an error but got none
+}
+
+func TestThatDeviationsThatCanNotBeConvertedDoNotHoldBackTheChangeID(t *testing.T) {
+	is, cb, ss, ms := setupMockSituation(t, []string{"Vägarbete", "Restriktion"}, 0, "")
+	defer ms.Close()
+
+	info, err := ss.publishSituations(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"Situation":[{"Deleted":false,"Deviation":[
+		{"Id":"SE_STA_TRISSID_1_100","MessageType":"Vägarbete","Geometry":{"Point":{"WGS84":"POINT (17.3058 62.3908)"}},"StartTime":"yesterday"},
+		{"Id":"SE_STA_TRISSID_2_100","MessageType":"Restriktion","Geometry":{"Point":{"WGS84":"POINT (17.3058 62.3908)"}},"StartTime":"2024-10-16T10:00:00.000+02:00"}
+	]}],"INFO":{"LASTCHANGEID":"7426311386101186963"}}]}}`))
+
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426311386101186963") // the change id should advance past the deviation with an invalid start time
+	is.Equal(len(cb.MergeEntityCalls()), 1)
+	is.Equal(cb.MergeEntityCalls()[0].EntityID, "urn:ngsi-ld:TrafficRestriction:se:trafikverket:api:deviation:SE_STA_TRISSID_2_100")
+}
+
+func TestThatUnsupportedMessageTypesAreRejected(t *testing.T) {
+	is, _, ss, ms := setupMockSituation(t, []string{"Vägarbete", "Okänd"}, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	_, err := ss.Start(context.Background())
+	is.True(err != nil) // expected an error but got none
+}
+
+func setupMockSituation(t *testing.T, messageTypes []string, tfvCode int, tfvBody string) (*is.I, *test.ContextBrokerClientMock, *situationSvc, MockService) {
+	is := is.New(t)
+	tfvMock := NewMockServiceThat(
+		Expects(is, expects.RequestBodyContaining(`<IN name="Deviation.MessageType" value="Vägarbete,Restriktion`)),
+		Returns(
+			response.Code(tfvCode),
+			response.Body([]byte(tfvBody)),
+		),
+	)
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return nil, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, ngsierrors.ErrNotFound
+		},
+	}
+
+	ss := NewService(context.Background(), "", tfvMock.URL(), "22", messageTypes, ctxBroker)
+
+	return is, ctxBroker, ss.(*situationSvc), tfvMock
+}
+
+const tfvResponseJSON string = `{"RESPONSE":{"RESULT":[{"Situation":[
+	{"Deleted":false,"Deviation":[
+		{"Id":"SE_STA_TRISSID_1_100","MessageType":"Vägarbete","MessageCode":"Vägarbete","IconId":"roadwork","Message":"Beläggningsarbete.","Geometry":{"Point":{"WGS84":"POINT (17.3058 62.3908)"}},"StartTime":"2024-10-16T10:00:00.000+02:00","EndTime":"2024-11-16T17:00:00.000+01:00"},
+		{"Id":"SE_STA_TRISSID_2_100","MessageType":"Restriktion","MessageCode":"Viktbegränsning","IconId":"weightRestriction","Geometry":{"Point":{"WGS84":"POINT (17.3058 62.3908)"}},"StartTime":"2024-10-16T10:00:00.000+02:00"}
+	]},
+	{"Deleted":true,"Deviation":[
+		{"Id":"SE_STA_TRISSID_1_200","MessageType":"Hinder","MessageCode":"Fordon på vägen","IconId":"obstacle","SeverityCode":4,"SeverityText":"Stor påverkan","Geometry":{"Point":{"WGS84":"POINT (17.4 62.4)"}},"StartTime":"2024-10-16T11:00:00.000+02:00"},
+		{"Id":"SE_STA_TRISSID_2_200","MessageType":"Olycka","IconId":"roadAccident","StartTime":"2024-10-16T11:00:00.000+02:00"}
+	]}
+],"INFO":{"LASTCHANGEID":"7426311386101186963"}}]}}`
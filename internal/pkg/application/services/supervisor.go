@@ -0,0 +1,253 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// Unit is a service that is run by a Supervisor under a unique name
+type Unit struct {
+	Name string
+	// Definition is whatever the service was created from. A running unit is restarted when it is applied
+	// again with a definition that is not deeply equal to the one it was started with.
+	Definition any
+	// Create creates the service when the unit is started or restarted
+	Create func(ctx context.Context) (Starter, error)
+	// StopOrder orders the units when the Supervisor is stopped. Units with a higher order are stopped after
+	// those with a lower one, so that a unit that other units publish through can outlive them.
+	StopOrder int
+}
+
+// Supervisor runs services, each with a context of its own so that they can be stopped, started and
+// restarted one by one while the others keep running. A service that fails to start, or that stops
+// without being asked to, such as a poller that has recovered from a panic, is restarted with an
+// exponential backoff.
+type Supervisor struct {
+	registry   *Registry
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	running map[string]*supervised
+}
+
+type supervised struct {
+	definition any
+	stopOrder  int
+	stop       context.CancelFunc
+	stopped    chan struct{}
+}
+
+// NewSupervisor creates a Supervisor that is not running any services. The state and restarts of every
+// service are reported to registry, if not nil, and the status of a stopped service is removed from it.
+func NewSupervisor(registry *Registry, options ...func(*Supervisor)) *Supervisor {
+	s := &Supervisor{
+		registry:   registry,
+		minBackoff: time.Second,
+		maxBackoff: 5 * time.Minute,
+		running:    map[string]*supervised{},
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	return s
+}
+
+// RestartBackoff sets the shortest and the longest time to wait before a service is restarted. The wait
+// is doubled for every restart, and starts over once a service has been running for maxBackoff.
+func RestartBackoff(minBackoff, maxBackoff time.Duration) func(*Supervisor) {
+	return func(s *Supervisor) {
+		s.minBackoff = minBackoff
+		s.maxBackoff = max(minBackoff, maxBackoff)
+	}
+}
+
+// Apply makes the Supervisor run exactly the given units. Running units that are not given are stopped,
+// units with changed definitions are restarted and new units are started. The reasons that units could
+// not be started are returned as a single error, while they are retried in the background.
+func (s *Supervisor) Apply(ctx context.Context, units ...Unit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	logger := logging.GetFromContext(ctx)
+	wanted := map[string]bool{}
+
+	for _, u := range units {
+		wanted[u.Name] = true
+	}
+
+	for name := range s.running {
+		if !wanted[name] {
+			logger.Info("stopping service", "service", name)
+			s.stop(name)
+		}
+	}
+
+	errs := []error{}
+
+	for _, u := range units {
+		if r, ok := s.running[u.Name]; ok {
+			if reflect.DeepEqual(r.definition, u.Definition) {
+				continue
+			}
+
+			logger.Info("restarting service with changed definition", "service", u.Name)
+			s.stop(u.Name)
+		}
+
+		err := s.start(ctx, u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", u.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stop stops every service, in the stop order of their units, and waits for them to shut down
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := slices.SortedFunc(maps.Keys(s.running), func(a, b string) int {
+		return cmp.Or(cmp.Compare(s.running[a].stopOrder, s.running[b].stopOrder), cmp.Compare(a, b))
+	})
+
+	for _, name := range names {
+		s.stop(name)
+	}
+}
+
+// Running returns the names of the services that are supervised, including those waiting to be restarted
+func (s *Supervisor) Running() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.running))
+	for name := range s.running {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// start makes the first attempt to start a unit and returns its error, if any. The unit is then kept
+// running, and restarted whenever it stops or fails to start, by a goroutine of its own until it is stopped.
+func (s *Supervisor) start(ctx context.Context, u Unit) error {
+	ctx, stop := context.WithCancel(ctx)
+
+	r := &supervised{
+		definition: u.Definition,
+		stopOrder:  u.StopOrder,
+		stop:       stop,
+		stopped:    make(chan struct{}),
+	}
+	s.running[u.Name] = r
+
+	done, err := s.startOnce(ctx, u)
+	if err != nil {
+		s.report(u.Name, "restarting", err.Error(), false)
+	}
+
+	go func() {
+		defer close(r.stopped)
+		s.supervise(ctx, u, done, err)
+	}()
+
+	return err
+}
+
+// supervise waits for a started service to stop and restarts it, after a backoff, for as long as ctx
+// is not cancelled. A nil done channel means that the previous attempt to start the service failed.
+func (s *Supervisor) supervise(ctx context.Context, u Unit, done chan struct{}, err error) {
+	logger := logging.GetFromContext(ctx).With("service", u.Name)
+	backoff := s.minBackoff
+
+	for {
+		if done != nil {
+			s.report(u.Name, "running", "", false)
+			startedAt := time.Now()
+
+			select {
+			case <-done:
+			case <-ctx.Done():
+				<-done
+				return
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			err = errors.New("service stopped unexpectedly")
+
+			if time.Since(startedAt) >= s.maxBackoff {
+				backoff = s.minBackoff
+			}
+		}
+
+		logger.Error("restarting service", "err", err.Error(), "backoff", backoff.String())
+		s.report(u.Name, "restarting", err.Error(), false)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff = min(backoff*2, s.maxBackoff)
+
+		restarted(ctx, u.Name)
+		s.report(u.Name, "restarting", err.Error(), true)
+
+		done, err = s.startOnce(ctx, u)
+	}
+}
+
+// startOnce creates and starts a unit, and turns a panic while doing so into an error
+func (s *Supervisor) startOnce(ctx context.Context, u Unit) (done chan struct{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.GetFromContext(ctx).Error("panic while starting service", "service", u.Name, "panic", fmt.Sprint(r), "stack", string(debug.Stack()))
+			done, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	svc, err := u.Create(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.Start(ctx)
+}
+
+func (s *Supervisor) report(name, state, lastError string, restarted bool) {
+	if s.registry != nil {
+		s.registry.supervised(name, state, lastError, restarted)
+	}
+}
+
+// stop cancels the context of a supervised service and waits for it to shut down
+func (s *Supervisor) stop(name string) {
+	r := s.running[name]
+	delete(s.running, name)
+
+	r.stop()
+	<-r.stopped
+
+	if s.registry != nil {
+		s.registry.remove(name)
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/matryer/is"
+)
+
+func TestSupervisorAppliesChangedUnits(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewRegistry(nil)
+	supervisor := NewSupervisor(registry)
+	started := map[string]int{}
+
+	unit := func(name string, interval time.Duration) Unit {
+		return Unit{
+			Name:       name,
+			Definition: interval,
+			Create: func(ctx context.Context) (Starter, error) {
+				started[name]++
+				poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+					return trafikverket.Info{}, nil
+				}
+				return NewPoller(name, interval, poll, Register(registry)), nil
+			},
+		}
+	}
+
+	is.NoErr(supervisor.Apply(ctx, unit("a", time.Hour), unit("b", time.Hour)))
+	is.NoErr(supervisor.Apply(ctx, unit("a", time.Hour), unit("c", time.Hour), unit("b", time.Minute)))
+
+	running := supervisor.Running()
+	slices.Sort(running)
+	is.Equal(running, []string{"a", "b", "c"})
+	is.Equal(started, map[string]int{"a": 1, "b": 2, "c": 1}) // only the changed unit should be restarted
+
+	is.NoErr(supervisor.Apply(ctx, unit("c", time.Hour)))
+	is.Equal(supervisor.Running(), []string{"c"})
+
+	statuses := registry.Status()
+	is.Equal(len(statuses), 1) // stopped units should no longer be reported
+	is.Equal(statuses[0].Name, "c")
+
+	supervisor.Stop()
+	is.Equal(len(supervisor.Running()), 0)
+}
+
+func TestSupervisorRestartsPollersThatPanic(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewRegistry(nil)
+	supervisor := NewSupervisor(registry, RestartBackoff(time.Millisecond, 10*time.Millisecond))
+
+	attempts := make(chan int, 10)
+	polls := 0
+
+	unit := Unit{
+		Name: "test",
+		Create: func(ctx context.Context) (Starter, error) {
+			poll := func(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+				polls++
+				attempts <- polls
+				if polls < 3 {
+					var result []trafikverket.Info
+					return result[0], nil // a bad response should only take down this poller
+				}
+				return trafikverket.Info{LastChangeID: "1"}, nil
+			}
+			return NewPoller("test", time.Millisecond, poll, Register(registry)), nil
+		},
+	}
+
+	is.NoErr(supervisor.Apply(ctx, unit))
+
+	for n := range attempts {
+		if n == 3 {
+			break
+		}
+	}
+
+	supervisor.Stop()
+
+	is.Equal(polls, 3)
+}
+
+func TestSupervisorRetriesServicesThatFailToStart(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	registry := NewRegistry(nil)
+	supervisor := NewSupervisor(registry, RestartBackoff(time.Hour, time.Hour))
+
+	unit := Unit{
+		Name: "test",
+		Create: func(ctx context.Context) (Starter, error) {
+			return nil, errors.New("not today")
+		},
+	}
+
+	is.True(supervisor.Apply(ctx, unit) != nil)
+
+	statuses, ready := registry.Ready()
+	is.True(!ready) // a service that is waiting to be restarted should not be ready
+	is.Equal(statuses[0].State, "restarting")
+	is.Equal(statuses[0].LastError, "not today")
+
+	supervisor.Stop()
+	is.Equal(len(registry.Status()), 0)
+}
+
+func TestSupervisorStopsUnitsInStopOrder(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	supervisor := NewSupervisor(nil)
+	stopped := []string{}
+
+	unit := func(name string, stopOrder int) Unit {
+		return Unit{
+			Name:      name,
+			StopOrder: stopOrder,
+			Create: func(ctx context.Context) (Starter, error) {
+				return starterFunc(func(ctx context.Context) (chan struct{}, error) {
+					done := make(chan struct{})
+					go func() {
+						<-ctx.Done()
+						stopped = append(stopped, name)
+						close(done)
+					}()
+					return done, nil
+				}), nil
+			},
+		}
+	}
+
+	is.NoErr(supervisor.Apply(ctx, unit("dedup", 2), unit("outbox", 1), unit("weather", 0), unit("cameras", 0)))
+
+	supervisor.Stop()
+	is.Equal(stopped, []string{"cameras", "weather", "outbox", "dedup"}) // feeds should be stopped before the units they publish through
+}
+
+type starterFunc func(ctx context.Context) (chan struct{}, error)
+
+func (f starterFunc) Start(ctx context.Context) (chan struct{}, error) {
+	return f(ctx)
+}
@@ -0,0 +1,56 @@
+package trafficflow
+
+import (
+	"context"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+)
+
+func (tfs *trafficFlowSvc) getTrafficFlowFromTFV(ctx context.Context, lastChangeID string) ([]byte, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-traffic-flow")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	body, err := tfs.tfv.Query(ctx, tfs.newQuery(lastChangeID))
+	return body, err
+}
+
+func (tfs *trafficFlowSvc) newQuery(lastChangeID string) trafikverket.Query {
+	filters := []trafikverket.Filter{}
+
+	if len(tfs.counties) == 1 {
+		filters = append(filters, trafikverket.Eq("CountyNo", tfs.counties[0]))
+	} else if len(tfs.counties) > 1 {
+		filters = append(filters, trafikverket.In("CountyNo", tfs.counties...))
+	}
+
+	filters = append(filters, tfs.filters...)
+
+	options := []trafikverket.QueryOption{
+		trafikverket.Namespace("road.trafficinfo"),
+		trafikverket.ChangeID(lastChangeID),
+		trafikverket.IncludeDeletedObjects(),
+		trafikverket.Where(filters...),
+		trafikverket.Include(
+			"SiteId",
+			"Deleted",
+			"CountyNo",
+			"SpecificLane",
+			"MeasurementSide",
+			"VehicleType",
+			"VehicleFlowRate",
+			"AverageVehicleSpeed",
+			"MeasurementOrCalculationPeriod",
+			"MeasurementTime",
+			"ModifiedTime",
+			"Geometry.WGS84",
+		),
+	}
+
+	if tfs.streaming {
+		options = append(options, trafikverket.SSEURL())
+	}
+
+	return trafikverket.NewQuery("TrafficFlow", "1.5", options...)
+}
@@ -0,0 +1,35 @@
+package trafficflow
+
+import (
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+)
+
+type geometry struct {
+	Position string `json:"WGS84"`
+}
+
+type tfvTrafficFlow struct {
+	SiteId                         int       `json:"SiteId"`
+	Deleted                        bool      `json:"Deleted"`
+	CountyNo                       int       `json:"CountyNo"`
+	SpecificLane                   string    `json:"SpecificLane"`
+	MeasurementSide                string    `json:"MeasurementSide"`
+	VehicleType                    string    `json:"VehicleType"`
+	VehicleFlowRate                int       `json:"VehicleFlowRate"`
+	AverageVehicleSpeed            float64   `json:"AverageVehicleSpeed"`
+	MeasurementOrCalculationPeriod int       `json:"MeasurementOrCalculationPeriod"`
+	MeasurementTime                time.Time `json:"MeasurementTime"`
+	ModifiedTime                   time.Time `json:"ModifiedTime"`
+	Geometry                       geometry  `json:"Geometry"`
+}
+
+type tfvResponse struct {
+	Response struct {
+		Result []struct {
+			TrafficFlow []tfvTrafficFlow  `json:"TrafficFlow"`
+			Info        trafikverket.Info `json:"INFO"`
+		} `json:"RESULT"`
+	} `json:"RESPONSE"`
+}
@@ -0,0 +1,90 @@
+package trafficflow
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
+	geo "github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+)
+
+func newTrafficFlowObservedEntity(tf tfvTrafficFlow) (publisher.Entity, error) {
+	attributes, err := convertTrafficFlowToFiwareEntity(tf)
+	if err != nil {
+		return publisher.Entity{}, fmt.Errorf("failed to create attribute for fiware entity: %s", err.Error())
+	}
+
+	return publisher.Entity{
+		ID:         fiware.TrafficFlowObservedIDPrefix + "se:trafikverket:api:trafficflow:" + trafficFlowID(tf),
+		Type:       fiware.TrafficFlowObservedTypeName,
+		Attributes: attributes,
+		Counties:   publisher.CountyNumbers(tf.CountyNo),
+	}, nil
+}
+
+// trafficFlowID identifies a traffic flow by its measurement site and lane, and by vehicle type
+// if the site counts different types of vehicles separately
+func trafficFlowID(tf tfvTrafficFlow) string {
+	id := fmt.Sprintf("%d:%s", tf.SiteId, tf.SpecificLane)
+
+	if tf.VehicleType != "" && tf.VehicleType != "anyVehicle" {
+		id = id + ":" + tf.VehicleType
+	}
+
+	return id
+}
+
+func convertTrafficFlowToFiwareEntity(tf tfvTrafficFlow) ([]entities.EntityDecoratorFunc, error) {
+	location, err := geo.ParsePoint(tf.Geometry.Position)
+	if err != nil {
+		return nil, err
+	}
+
+	observedTo := tf.MeasurementTime.UTC()
+	utcTime := observedTo.Format(time.RFC3339)
+
+	attributes := append(
+		make([]entities.EntityDecoratorFunc, 0, 9),
+		geo.Location(location),
+		decorators.DateObserved(utcTime),
+		decorators.DateTime("dateObservedTo", utcTime),
+		number("averageVehicleSpeed", tf.AverageVehicleSpeed, utcTime),
+	)
+
+	// VehicleFlowRate is given in vehicles per hour, while intensity is the number of vehicles
+	// counted during the observation period
+	if tf.MeasurementOrCalculationPeriod > 0 {
+		period := time.Duration(tf.MeasurementOrCalculationPeriod) * time.Second
+		intensity := math.Round(float64(tf.VehicleFlowRate) * period.Hours())
+
+		attributes = append(attributes,
+			decorators.DateTime("dateObservedFrom", observedTo.Add(-period).Format(time.RFC3339)),
+			number("intensity", intensity, utcTime),
+		)
+	}
+
+	if laneID, err := strconv.Atoi(strings.TrimPrefix(tf.SpecificLane, "lane")); err == nil {
+		attributes = append(attributes, decorators.Number("laneId", float64(laneID)))
+	}
+
+	if tf.VehicleType != "" {
+		attributes = append(attributes, decorators.Text("vehicleType", tf.VehicleType))
+	}
+
+	if tf.MeasurementSide != "" {
+		attributes = append(attributes, decorators.Text("measurementSide", tf.MeasurementSide))
+	}
+
+	return attributes, nil
+}
+
+func number(property string, value float64, at string) entities.EntityDecoratorFunc {
+	return decorators.Number(property, value, properties.ObservedAt(at))
+}
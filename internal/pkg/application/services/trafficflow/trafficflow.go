@@ -0,0 +1,201 @@
+package trafficflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+type TrafficFlowSvc interface {
+	services.Starter
+}
+
+type trafficFlowSvc struct {
+	name     string
+	tfv      trafikverket.Client
+	counties []string
+	filters  []trafikverket.Filter
+
+	interval    time.Duration
+	streaming   bool
+	checkpoints checkpoint.Store
+	registry    *services.Registry
+
+	publisher publisher.Publisher
+}
+
+var tracer = otel.Tracer("trafficflow")
+
+// NewService creates a service that publishes vehicle flow and average speed, per measurement site and lane,
+// as TrafficFlowObserved entities
+func NewService(_ context.Context, authKey, tfvURL, countyCode string, ctxBroker client.ContextBrokerClient, options ...func(*trafficFlowSvc)) TrafficFlowSvc {
+	tfs := &trafficFlowSvc{
+		tfv:       trafikverket.NewClient(authKey, tfvURL),
+		name:      "trafficflow",
+		interval:  30 * time.Second,
+		publisher: publisher.NewPublisher(ctxBroker),
+	}
+
+	if countyCode != "" {
+		tfs.counties = []string{countyCode}
+	}
+
+	for _, option := range options {
+		option(tfs)
+	}
+
+	return tfs
+}
+
+// Filters adds filter expressions that are combined with the county filter when querying for traffic flow
+func Filters(filters ...trafikverket.Filter) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.filters = append(tfs.filters, filters...)
+	}
+}
+
+// Publisher replaces the default publisher, that merges one entity at a time into the context broker
+func Publisher(p publisher.Publisher) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.publisher = p
+	}
+}
+
+// Counties replaces the county code with the numbers of one or more counties to ingest traffic flow from
+func Counties(codes ...string) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.counties = codes
+	}
+}
+
+// Name replaces the default name, trafficflow, of the service so that several instances can be told apart
+func Name(name string) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.name = name
+	}
+}
+
+// Interval replaces the default interval of 30 seconds between polls for traffic flow
+func Interval(interval time.Duration) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.interval = interval
+	}
+}
+
+// Streaming makes the service subscribe to a stream of changes instead of polling every interval
+func Streaming(enabled bool) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.streaming = enabled
+	}
+}
+
+// Checkpoints makes the service resume from, and record, the last published change id in store
+func Checkpoints(store checkpoint.Store) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.checkpoints = store
+	}
+}
+
+// Registry makes the service report its status to registry, and pause polling while the Trafikverket API is unavailable
+func Registry(registry *services.Registry) func(*trafficFlowSvc) {
+	return func(tfs *trafficFlowSvc) {
+		tfs.registry = registry
+	}
+}
+
+func (tfs *trafficFlowSvc) Start(ctx context.Context) (chan struct{}, error) {
+	options := []func(*services.Poller){}
+
+	if tfs.streaming {
+		options = append(options, services.Streaming(tfs.tfv, tfs.publishTrafficFlow))
+	}
+
+	if tfs.checkpoints != nil {
+		key := tfs.name + ":" + tfs.newQuery("").Fingerprint()
+		options = append(options, services.Checkpoints(tfs.checkpoints, key))
+	}
+
+	if tfs.registry != nil {
+		options = append(options, services.Register(tfs.registry))
+	}
+
+	return services.NewPoller(tfs.name, tfs.interval, tfs.getAndPublishTrafficFlow, options...).Start(ctx)
+}
+
+func (tfs *trafficFlowSvc) getAndPublishTrafficFlow(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "get-and-publish")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	resp, err := tfs.getTrafficFlowFromTFV(ctx, lastChangeID)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	info, err := tfs.publishTrafficFlow(ctx, resp)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	return info, nil
+}
+
+// publishTrafficFlow publishes the traffic flow in a response, or a streamed event, from the Trafikverket API
+func (tfs *trafficFlowSvc) publishTrafficFlow(ctx context.Context, resp []byte) (trafikverket.Info, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "publish-traffic-flow")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, logger := o11y.AddTraceIDToLoggerAndStoreInContext(span, logging.GetFromContext(ctx), ctx)
+
+	logger.Debug("received response", "body", string(resp))
+
+	tfvResp := &tfvResponse{}
+	err = json.Unmarshal(resp, tfvResp)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	if len(tfvResp.Response.Result) == 0 {
+		err = errors.New("response contained no result")
+		return trafikverket.Info{}, err
+	}
+
+	ingestion := services.NewIngestion(tfs.name)
+	ingestion.Fetched(ctx, "TrafficFlow", len(tfvResp.Response.Result[0].TrafficFlow))
+
+	batch := services.NewBatch(ingestion)
+
+	for _, tf := range tfvResp.Response.Result[0].TrafficFlow {
+		if tf.Deleted {
+			logger.Debug("ignoring deleted traffic flow", "site", tf.SiteId, "lane", tf.SpecificLane)
+			ingestion.Skipped(ctx, "TrafficFlow", 1)
+			continue
+		}
+
+		ingestion.Observed(tf.MeasurementTime)
+
+		batch.Convert(ctx, fiware.TrafficFlowObservedTypeName, func() (publisher.Entity, error) {
+			return newTrafficFlowObservedEntity(tf)
+		}, "site", tf.SiteId, "lane", tf.SpecificLane)
+	}
+
+	_, err = batch.Publish(ctx, tfs.publisher)
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	return tfvResp.Response.Result[0].Info, nil
+}
@@ -0,0 +1,79 @@
+package trafficflow
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	test "github.com/diwise/context-broker/pkg/test"
+	. "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/expects"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestRetrievingTrafficFlowFromTFV(t *testing.T) {
+	is, _, tfs, ms := setupMockTrafficFlow(t, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	_, err := tfs.getTrafficFlowFromTFV(context.Background(), "0")
+	is.NoErr(err)
+}
+
+func TestThatTrafficFlowIsPublishedAsTrafficFlowObserved(t *testing.T) {
+	is, cb, tfs, ms := setupMockTrafficFlow(t, http.StatusOK, tfvResponseJSON)
+	defer ms.Close()
+
+	info, err := tfs.getAndPublishTrafficFlow(context.Background(), "0")
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426311386101186964")
+
+	is.Equal(len(cb.CreateEntityCalls()), 2) // the deleted traffic flow should be ignored
+
+	entity := cb.CreateEntityCalls()[0].Entity
+	is.Equal(entity.ID(), "urn:ngsi-ld:TrafficFlowObserved:se:trafikverket:api:trafficflow:1438:lane1")
+	is.Equal(entity.Type(), "TrafficFlowObserved")
+	is.NoErr(entities.ValidateFragmentAttributes(entity, map[string]any{
+		"intensity":           12,
+		"averageVehicleSpeed": 72.5,
+		"laneId":              1,
+		"dateObservedFrom":    "2024-12-03T06:55:00Z",
+		"dateObservedTo":      "2024-12-03T07:00:00Z",
+	}))
+
+	is.Equal(cb.CreateEntityCalls()[1].Entity.ID(), "urn:ngsi-ld:TrafficFlowObserved:se:trafikverket:api:trafficflow:1438:lane2:lorry")
+}
+
+func setupMockTrafficFlow(t *testing.T, tfvCode int, tfvBody string) (*is.I, *test.ContextBrokerClientMock, *trafficFlowSvc, MockService) {
+	is := is.New(t)
+	tfvMock := NewMockServiceThat(
+		Expects(is, expects.RequestBodyContaining(`objecttype="TrafficFlow"`)),
+		Returns(
+			response.Code(tfvCode),
+			response.Body([]byte(tfvBody)),
+		),
+	)
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return nil, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, ngsierrors.ErrNotFound
+		},
+	}
+
+	tfs := NewService(context.Background(), "", tfvMock.URL(), "22", ctxBroker)
+
+	return is, ctxBroker, tfs.(*trafficFlowSvc), tfvMock
+}
+
+const tfvResponseJSON string = `{"RESPONSE":{"RESULT":[{"TrafficFlow":[
+	{"SiteId":1438,"Deleted":false,"CountyNo":22,"SpecificLane":"lane1","MeasurementSide":"northBound","VehicleType":"anyVehicle","VehicleFlowRate":144,"AverageVehicleSpeed":72.5,"MeasurementOrCalculationPeriod":300,"MeasurementTime":"2024-12-03T08:00:00.000+01:00","Geometry":{"WGS84":"POINT (17.3058 62.3908)"}},
+	{"SiteId":1438,"Deleted":false,"CountyNo":22,"SpecificLane":"lane2","MeasurementSide":"southBound","VehicleType":"lorry","VehicleFlowRate":24,"AverageVehicleSpeed":68.0,"MeasurementOrCalculationPeriod":300,"MeasurementTime":"2024-12-03T08:00:00.000+01:00","Geometry":{"WGS84":"POINT (17.3058 62.3908)"}},
+	{"SiteId":1439,"Deleted":true,"SpecificLane":"lane1","Geometry":{"WGS84":"POINT (17.4 62.4)"}}
+],"INFO":{"LASTCHANGEID":"7426311386101186964"}}]}}`
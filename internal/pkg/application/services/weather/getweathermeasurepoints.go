@@ -1,66 +1,70 @@
 package weathersvc
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"io"
-	"net/http"
-	"time"
 
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
-var httpClient = http.Client{
-	Transport: otelhttp.NewTransport(http.DefaultTransport),
-	Timeout:   10 * time.Second,
-}
-
 func (ws *weatherSvc) getWeatherMeasurepointStatus(ctx context.Context, lastChangeID string) ([]byte, error) {
 	var err error
 
 	ctx, span := tracer.Start(ctx, "get-weathermeasurepoints")
 	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-	const requestFmt string = `<REQUEST>
-	<LOGIN authenticationkey="%s" />
-	<QUERY objecttype="WeatherMeasurepoint" schemaversion="2.1" changeid="%s">
-		<INCLUDE>Deleted</INCLUDE>
-		<INCLUDE>Id</INCLUDE>
-		<INCLUDE>Geometry.WGS84</INCLUDE>
-		<INCLUDE>Observation.Air.RelativeHumidity.Value</INCLUDE>
-		<INCLUDE>Observation.Air.Temperature.Value</INCLUDE>
-		<INCLUDE>Observation.Wind.Direction.Value</INCLUDE>
-		<INCLUDE>Observation.Wind.Speed.Value</INCLUDE>
-		<INCLUDE>Observation.Sample</INCLUDE>
-		<INCLUDE>ModifiedTime</INCLUDE>
-		<INCLUDE>Name</INCLUDE>
-		<FILTER>
-			<WITHIN name="Geometry.SWEREF99TM" shape="box" value="%s" />
-		</FILTER>
-	</QUERY>
-</REQUEST>`
-	requestBody := fmt.Sprintf(requestFmt, ws.authenticationKey, lastChangeID, ws.weatherBox)
+	body, err := ws.tfv.Query(ctx, ws.newQuery(lastChangeID))
+	return body, err
+}
 
-	apiReq, err := http.NewRequestWithContext(ctx, http.MethodPost, ws.trafikverketURL, bytes.NewBufferString(requestBody))
-	if err != nil {
-		err = fmt.Errorf("failed to create http request: %s", err.Error())
-		return []byte{}, err
-	}
-	apiReq.Header.Set("Content-Type", "text/xml")
+func (ws *weatherSvc) newQuery(lastChangeID string) trafikverket.Query {
+	filters := append(
+		[]trafikverket.Filter{ws.area},
+		ws.filters...,
+	)
 
-	apiResponse, err := httpClient.Do(apiReq)
-	if err != nil {
-		err = fmt.Errorf("failed to retrieve weathermeasurepoints: %s", err.Error())
-		return nil, err
+	options := []trafikverket.QueryOption{
+		trafikverket.ChangeID(lastChangeID),
+		trafikverket.IncludeDeletedObjects(),
+		trafikverket.Include(
+			"Deleted",
+			"Id",
+			"Geometry.WGS84",
+			"Observation.Weather.Precipitation",
+			"Observation.Sample",
+			"Observation.Wind.Height",
+			"ModifiedTime",
+			"Name",
+		),
+		// WeatherMeasurepoint does not report the air pressure, so there is no atmosphericPressure to include
+		trafikverket.Include(sensorValues(
+			"Observation.Air.RelativeHumidity",
+			"Observation.Air.Temperature",
+			"Observation.Air.Dewpoint",
+			"Observation.Air.VisibleDistance",
+			"Observation.Wind.Direction",
+			"Observation.Wind.Speed",
+			"Observation.Aggregated10minutes.Precipitation.TotalWaterEquivalent",
+			"Observation.Aggregated10minutes.Wind.SpeedAverage",
+			"Observation.Aggregated10minutes.Wind.SpeedMax",
+			"Observation.Surface.Grip",
+			"Observation.Surface.Temperature",
+		)...),
+		trafikverket.Where(filters...),
 	}
-	defer apiResponse.Body.Close()
 
-	if apiResponse.StatusCode != http.StatusOK {
-		err = fmt.Errorf("expected status code %d, but got %d", http.StatusOK, apiResponse.StatusCode)
-		return []byte{}, err
+	if ws.streaming {
+		options = append(options, trafikverket.SSEURL())
 	}
 
-	return io.ReadAll(apiResponse.Body)
+	return trafikverket.NewQuery("WeatherMeasurepoint", "2.1", options...)
+}
+
+// sensorValues returns the fields to include for the value, origin and sensor names of each observation
+func sensorValues(observations ...string) []string {
+	fields := make([]string, 0, len(observations)*3)
+	for _, o := range observations {
+		fields = append(fields, o+".Value", o+".Origin", o+".SensorNames")
+	}
+	return fields
 }
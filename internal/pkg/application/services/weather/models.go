@@ -1,6 +1,10 @@
 package weathersvc
 
-import "time"
+import (
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
+)
 
 type osv struct {
 	Origin      string  `json:"Origin"`
@@ -13,18 +17,44 @@ type geometry struct {
 }
 
 type observation struct {
-	Air  *air   `json:"Air,omitempty"`
-	Wind []wind `json:"Wind"`
+	Sample              time.Time   `json:"Sample"`
+	Air                 *air        `json:"Air,omitempty"`
+	Wind                []wind      `json:"Wind"`
+	Surface             *surface    `json:"Surface,omitempty"`
+	Weather             *weather    `json:"Weather,omitempty"`
+	Aggregated10minutes *aggregated `json:"Aggregated10minutes,omitempty"`
 }
 
 type air struct {
-	Temperature      osv `json:"Temperature"`
-	RelativeHumidity osv `json:"RelativeHumidity"`
+	Temperature      *osv `json:"Temperature,omitempty"`
+	RelativeHumidity *osv `json:"RelativeHumidity,omitempty"`
+	Dewpoint         *osv `json:"Dewpoint,omitempty"`
+	VisibleDistance  *osv `json:"VisibleDistance,omitempty"`
+}
+
+type surface struct {
+	Temperature *osv `json:"Temperature,omitempty"`
+	Grip        *osv `json:"Grip,omitempty"`
+}
+
+type weather struct {
+	Precipitation string `json:"Precipitation"`
+}
+
+type aggregated struct {
+	Precipitation *struct {
+		TotalWaterEquivalent *osv `json:"TotalWaterEquivalent,omitempty"`
+	} `json:"Precipitation,omitempty"`
+	Wind *struct {
+		SpeedAverage *osv `json:"SpeedAverage,omitempty"`
+		SpeedMax     *osv `json:"SpeedMax,omitempty"`
+	} `json:"Wind,omitempty"`
 }
 
 type wind struct {
-	Direction *osv `json:"Direction,omitempty"`
-	Speed     *osv `json:"Speed,omitempty"`
+	Direction *osv     `json:"Direction,omitempty"`
+	Speed     *osv     `json:"Speed,omitempty"`
+	Height    *float64 `json:"Height,omitempty"`
 }
 
 type weatherMeasurepoint struct {
@@ -40,9 +70,7 @@ type weatherMeasurepointResponse struct {
 	Response struct {
 		Result []struct {
 			WeatherMeasurepoints []weatherMeasurepoint `json:"WeatherMeasurepoint"`
-			Info                 struct {
-				LastChangeID string `json:"LASTCHANGEID"`
-			} `json:"INFO"`
+			Info                 trafikverket.Info     `json:"INFO"`
 		} `json:"RESULT"`
 	} `json:"RESPONSE"`
 }
@@ -1,99 +1,152 @@
 package weathersvc
 
 import (
-	"context"
-	"errors"
 	"fmt"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/diwise/context-broker/pkg/datamodels/fiware"
-	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
-	"github.com/diwise/context-broker/pkg/ngsild/types"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
 	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
-	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	geo "github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
 )
 
-func (ws *weatherSvc) publishWeatherMeasurepointStatus(ctx context.Context, measurepoint weatherMeasurepoint) (err error) {
-	_, span := tracer.Start(ctx, "publish-weatherobservations")
-	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
-
-	var attributes []entities.EntityDecoratorFunc
-	attributes, err = convertWeatherMeasurepointToFiwareEntity(measurepoint)
-
+func newWeatherObservedEntity(measurepoint weatherMeasurepoint, wind WindSensors) (publisher.Entity, error) {
+	attributes, err := convertWeatherMeasurepointToFiwareEntity(measurepoint, wind)
 	if err != nil {
-		err = fmt.Errorf("could not create attributes for weathermeasurepoint: %s", err.Error())
-		return
+		return publisher.Entity{}, fmt.Errorf("could not create attributes for weathermeasurepoint: %s", err.Error())
 	}
 
-	fragment, _ := entities.NewFragment(attributes...)
-	entityID := fiware.WeatherObservedIDPrefix + "se:trafikverket:api:weathermeasurepoint:" + measurepoint.ID
-
-	headers := map[string][]string{"Content-Type": {"application/ld+json"}}
+	return publisher.Entity{
+		ID:         weatherObservedID(measurepoint.ID),
+		Type:       fiware.WeatherObservedTypeName,
+		Attributes: attributes,
+	}, nil
+}
 
-	_, err = ws.ctxBrokerClient.MergeEntity(ctx, entityID, fragment, headers)
-	if err != nil {
-		if !errors.Is(err, ngsierrors.ErrNotFound) {
-			err = fmt.Errorf("failed to merge entity: %s", err.Error())
-			return
-		}
+// newInactiveWeatherObservedEntity returns an entity that marks a station that has been deleted, or retired,
+// as inactive. The location is kept, if known, so that the entity is routed to the same tenant as before.
+func newInactiveWeatherObservedEntity(measurepointID, position string) publisher.Entity {
+	attributes := []entities.EntityDecoratorFunc{decorators.Status("inactive")}
 
-		var entity types.Entity
-		entity, err = entities.New(entityID, fiware.WeatherObservedTypeName, attributes...)
-		if err != nil {
-			err = fmt.Errorf("entities.New failed: %s", err.Error())
-			return
-		}
+	if location, err := geo.ParsePoint(position); err == nil {
+		attributes = append(attributes, geo.Location(location))
+	}
 
-		_, err = ws.ctxBrokerClient.CreateEntity(ctx, entity, headers)
-		if err != nil {
-			err = fmt.Errorf("failed to post weather observed to context broker: %s", err.Error())
-			return
-		}
+	return publisher.Entity{
+		ID:         weatherObservedID(measurepointID),
+		Type:       fiware.WeatherObservedTypeName,
+		Attributes: attributes,
 	}
+}
 
-	return nil
+func weatherObservedID(measurepointID string) string {
+	return fiware.WeatherObservedIDPrefix + "se:trafikverket:api:weathermeasurepoint:" + measurepointID
 }
 
-func convertWeatherMeasurepointToFiwareEntity(ws weatherMeasurepoint) ([]entities.EntityDecoratorFunc, error) {
-	position := ws.Geometry.Position
-	position = position[7 : len(position)-1]
+func convertWeatherMeasurepointToFiwareEntity(ws weatherMeasurepoint, wind WindSensors) ([]entities.EntityDecoratorFunc, error) {
+	location, err := geo.ParsePoint(ws.Geometry.Position)
+	if err != nil {
+		return nil, err
+	}
 
-	Longitude := strings.Split(position, " ")[0]
-	newLong, _ := strconv.ParseFloat(Longitude, 32)
-	Latitude := strings.Split(position, " ")[1]
-	newLat, _ := strconv.ParseFloat(Latitude, 32)
+	utcTime := ws.ModifiedTime.UTC().Format(time.RFC3339)
 
-	utcTime := ws.ModifiedTime.Format(time.RFC3339)
+	// every measurement is observed at the time that the sensors were sampled, if known
+	observedAt := utcTime
+	if !ws.Observation.Sample.IsZero() {
+		observedAt = ws.Observation.Sample.UTC().Format(time.RFC3339)
+	}
 
 	attributes := append(
 		make([]entities.EntityDecoratorFunc, 0, 7),
-		decorators.Location(newLat, newLong),
+		geo.Location(location),
 		decorators.Name(ws.Name),
 		decorators.DateObserved(utcTime),
+		decorators.Status("active"),
 	)
 
-	if ws.Observation.Air != nil {
-		attributes = append(attributes,
-			number("temperature", ws.Observation.Air.Temperature.Value, utcTime),
-			number("humidity", ws.Observation.Air.RelativeHumidity.Value/100.0, utcTime),
-		)
-	}
+	if air := ws.Observation.Air; air != nil {
+		if air.Temperature != nil {
+			attributes = append(attributes, measurement("temperature", *air.Temperature, observedAt))
+		}
 
-	if len(ws.Observation.Wind) > 0 && ws.Observation.Wind[0].Direction != nil && ws.Observation.Wind[0].Speed != nil {
-		attributes = append(
-			attributes,
-			number("windDirection", float64(ws.Observation.Wind[0].Direction.Value), utcTime),
-			number("windSpeed", ws.Observation.Wind[0].Speed.Value, utcTime),
-		)
+		if air.RelativeHumidity != nil {
+			humidity := *air.RelativeHumidity
+			humidity.Value = humidity.Value / 100.0
+			attributes = append(attributes, measurement("humidity", humidity, observedAt))
+		}
 	}
 
+	attributes = append(attributes, wind.windObservations(ws.Observation, observedAt)...)
+	attributes = append(attributes, optionalObservations(ws.Observation, observedAt)...)
+
 	return attributes, nil
 }
 
-func number(property string, value float64, at string) entities.EntityDecoratorFunc {
-	return decorators.Number(property, value, properties.ObservedAt(at))
+// optionalObservations returns the attributes for the values that are not reported by every measurepoint,
+// such as those of road surface sensors. There is no atmosphericPressure, since the air pressure is not
+// reported by any WeatherMeasurepoint.
+func optionalObservations(o observation, at string) []entities.EntityDecoratorFunc {
+	attributes := []entities.EntityDecoratorFunc{}
+
+	optional := func(property string, value *osv) {
+		if value != nil {
+			attributes = append(attributes, measurement(property, *value, at))
+		}
+	}
+
+	if o.Air != nil {
+		optional("dewPoint", o.Air.Dewpoint)
+		optional("visibility", o.Air.VisibleDistance)
+	}
+
+	if o.Aggregated10minutes != nil {
+		if o.Aggregated10minutes.Precipitation != nil {
+			optional("precipitation", o.Aggregated10minutes.Precipitation.TotalWaterEquivalent)
+		}
+	}
+
+	if o.Weather != nil && o.Weather.Precipitation != "" {
+		attributes = append(attributes, decorators.Text("precipitationType", o.Weather.Precipitation))
+	}
+
+	if o.Surface != nil {
+		optional("roadSurfaceTemperature", o.Surface.Temperature)
+		optional("grip", o.Surface.Grip)
+	}
+
+	return attributes
+}
+
+// measurement returns a number property observed at the given time, with sub-properties for the names
+// of the sensors that reported it and whether it was measured or calculated, when they are known
+func measurement(property string, value osv, at string) entities.EntityDecoratorFunc {
+	np := properties.NewNumberProperty(value.Value)
+	properties.ObservedAt(at)(np)
+
+	if value.SensorNames == "" && value.Origin == "" {
+		return entities.P(property, np)
+	}
+
+	return entities.P(property, &sensorProperty{
+		NumberProperty: np,
+		SensorName:     optionalText(value.SensorNames),
+		Origin:         optionalText(value.Origin),
+	})
+}
+
+// sensorProperty is a number property with sub-properties that tell where its value came from
+type sensorProperty struct {
+	*properties.NumberProperty
+	SensorName *properties.TextProperty `json:"sensorName,omitempty"`
+	Origin     *properties.TextProperty `json:"origin,omitempty"`
+}
+
+func optionalText(value string) *properties.TextProperty {
+	if value == "" {
+		return nil
+	}
+	return properties.NewTextProperty(value)
 }
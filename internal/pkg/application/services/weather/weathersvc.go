@@ -3,10 +3,15 @@ package weathersvc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/diwise/context-broker/pkg/datamodels/fiware"
 	"github.com/diwise/context-broker/pkg/ngsild/client"
 	"github.com/diwise/ingress-trafikverket/internal/pkg/application/services"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/trafikverket"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
 	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
@@ -17,103 +22,300 @@ type WeatherService interface {
 	services.Starter
 }
 
-func NewWeatherService(ctx context.Context, authKey, trafikverketURL, weatherBox string, ctxBrokerClient client.ContextBrokerClient) WeatherService {
-	return &weatherSvc{
-		authenticationKey: authKey,
-		trafikverketURL:   trafikverketURL,
-		weatherBox:        weatherBox,
-		ctxBrokerClient:   ctxBrokerClient,
-		interval:          30 * time.Second,
-		stations:          map[string]time.Time{},
+func NewWeatherService(ctx context.Context, authKey, trafikverketURL, weatherBox string, ctxBrokerClient client.ContextBrokerClient, options ...func(*weatherSvc)) WeatherService {
+	ws := &weatherSvc{
+		tfv:       trafikverket.NewClient(authKey, trafikverketURL),
+		area:      trafikverket.Within("Geometry.SWEREF99TM", "box", weatherBox),
+		publisher: publisher.NewPublisher(ctxBrokerClient),
+		name:      "weather",
+		interval:  30 * time.Second,
+		stations:  map[string]station{},
+	}
+
+	for _, option := range options {
+		option(ws)
+	}
+
+	return ws
+}
+
+// Area replaces the weather box with another filter on Geometry.SWEREF99TM, such as a polygon
+func Area(area trafikverket.Filter) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.area = area
+	}
+}
+
+// Filters adds filter expressions that are combined with the weather box when querying for measurepoints
+func Filters(filters ...trafikverket.Filter) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.filters = append(ws.filters, filters...)
+	}
+}
+
+// RetireAfter marks the entities of stations that have not been returned by the Trafikverket API for the
+// given duration as inactive. Stations are never retired if the duration is zero, which is the default.
+// The stations are kept in the checkpoint store, if any, so that stations that go missing while the
+// service is restarted are retired too.
+func RetireAfter(age time.Duration) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.retireAfter = age
 	}
 }
 
 type weatherSvc struct {
-	authenticationKey string
-	trafikverketURL   string
-	weatherBox        string
-	ctxBrokerClient   client.ContextBrokerClient
-	interval          time.Duration
-	stations          map[string]time.Time
+	name        string
+	tfv         trafikverket.Client
+	area        trafikverket.Filter
+	filters     []trafikverket.Filter
+	publisher   publisher.Publisher
+	interval    time.Duration
+	streaming   bool
+	checkpoints checkpoint.Store
+	registry    *services.Registry
+	wind        WindSensors
+	retireAfter time.Duration
+	stations    map[string]station
+}
+
+// Publisher replaces the default publisher, that merges one entity at a time into the context broker
+func Publisher(p publisher.Publisher) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.publisher = p
+	}
+}
+
+// Name replaces the default name, weather, of the service so that several instances can be told apart
+func Name(name string) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.name = name
+	}
+}
+
+// Interval replaces the default interval of 30 seconds between polls for measurepoints
+func Interval(interval time.Duration) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.interval = interval
+	}
+}
+
+// Streaming makes the service subscribe to a stream of changes instead of polling every interval
+func Streaming(enabled bool) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.streaming = enabled
+	}
+}
+
+// Checkpoints makes the service resume from, and record, the last published change id in store
+func Checkpoints(store checkpoint.Store) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.checkpoints = store
+	}
+}
+
+// Registry makes the service report its status to registry, and pause polling while the Trafikverket API is unavailable
+func Registry(registry *services.Registry) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.registry = registry
+	}
 }
 
 func (ws *weatherSvc) Start(ctx context.Context) (chan struct{}, error) {
+	options := []func(*services.Poller){}
 
-	done := make(chan struct{})
-
-	go func() {
-		var err error
-		lastChangeID := "0"
-
-		tmr := time.NewTicker(ws.interval)
-
-		defer func() {
-			tmr.Stop()
-			done <- struct{}{}
-		}()
-
-		for {
-			select {
-			case <-tmr.C:
-				{
-					lastChangeID, err = ws.getAndPublishWeatherMeasurepoints(ctx, lastChangeID)
-					if err != nil {
-						logging.GetFromContext(ctx).Error(
-							"failed to get and publish weather stations", "err", err.Error(),
-						)
-					}
-				}
-			case <-ctx.Done():
-				{
-					return
-				}
-			}
-		}
-	}()
+	if ws.streaming {
+		options = append(options, services.Streaming(ws.tfv, ws.publishWeatherMeasurepoints))
+	}
 
-	return done, nil
+	if ws.checkpoints != nil {
+		key := ws.name + ":" + ws.newQuery("").Fingerprint()
+		options = append(options, services.Checkpoints(ws.checkpoints, key))
+	}
+
+	if ws.registry != nil {
+		options = append(options, services.Register(ws.registry))
+	}
+
+	ws.loadStations(ctx)
+
+	return services.NewPoller(ws.name, ws.interval, ws.getAndPublishWeatherMeasurepoints, options...).Start(ctx)
 }
 
 var tracer = otel.Tracer("tfv-weathermeasurepoint-client")
 
-func (ws *weatherSvc) getAndPublishWeatherMeasurepoints(ctx context.Context, lastChangeID string) (string, error) {
+func (ws *weatherSvc) getAndPublishWeatherMeasurepoints(ctx context.Context, lastChangeID string) (trafikverket.Info, error) {
 	var err error
 
 	ctx, span := tracer.Start(ctx, "get-and-publish-status")
 	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
 
-	_, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
-		span, logging.GetFromContext(ctx), ctx,
-	)
-
 	responseBody, err := ws.getWeatherMeasurepointStatus(ctx, lastChangeID)
 	if err != nil {
-		return lastChangeID, err
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
 	}
 
+	info, err := ws.publishWeatherMeasurepoints(ctx, responseBody)
+	if err != nil {
+		return trafikverket.Info{LastChangeID: lastChangeID}, err
+	}
+
+	return info, nil
+}
+
+// publishWeatherMeasurepoints publishes the measurepoints in a response, or a streamed event, from the Trafikverket API
+func (ws *weatherSvc) publishWeatherMeasurepoints(ctx context.Context, responseBody []byte) (trafikverket.Info, error) {
+	var err error
+
+	ctx, span := tracer.Start(ctx, "publish-measurepoints")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	_, ctx, log := o11y.AddTraceIDToLoggerAndStoreInContext(
+		span, logging.GetFromContext(ctx), ctx,
+	)
+
 	log.Debug("received response", "body", string(responseBody))
 
 	answer := &weatherMeasurepointResponse{}
 	err = json.Unmarshal(responseBody, answer)
 	if err != nil {
-		return lastChangeID, err
+		return trafikverket.Info{}, err
+	}
+
+	if len(answer.Response.Result) == 0 {
+		err = errors.New("response contained no result")
+		return trafikverket.Info{}, err
 	}
 
+	inactive := map[string]string{}
+	now := time.Now()
+	stationsChanged := false
+
+	ingestion := services.NewIngestion(ws.name)
+	ingestion.Fetched(ctx, "WeatherMeasurepoint", len(answer.Response.Result[0].WeatherMeasurepoints))
+
+	batch := services.NewBatch(ingestion)
+
 	for _, measurepoint := range answer.Response.Result[0].WeatherMeasurepoints {
-		if !measurepoint.Deleted && measurepoint.Observation.Air != nil {
-			previousMeasureTime, ok := ws.stations[measurepoint.ID]
-			if ok && !measurepoint.ModifiedTime.After(previousMeasureTime) {
-				continue
+		ingestion.Observed(measurepoint.ModifiedTime)
+
+		if measurepoint.Deleted {
+			position := measurepoint.Geometry.Position
+			if position == "" {
+				position = ws.stations[measurepoint.ID].Position
 			}
 
-			ws.stations[measurepoint.ID] = measurepoint.ModifiedTime
+			log.Debug("marking deleted weathermeasurepoint as inactive", "measurepoint", measurepoint.ID)
+			entity := newInactiveWeatherObservedEntity(measurepoint.ID, position)
+			batch.Add(entity)
+			inactive[entity.ID] = measurepoint.ID
+			continue
+		}
+
+		ws.stations[measurepoint.ID] = station{Position: measurepoint.Geometry.Position, Seen: now}
+		stationsChanged = true
 
-			err = ws.publishWeatherMeasurepointStatus(ctx, measurepoint)
-			if err != nil {
-				log.Error("unable to publish data for weathermeasurepoint", "measurepoint", measurepoint.ID, "err", err)
-			}
+		batch.Convert(ctx, fiware.WeatherObservedTypeName, func() (publisher.Entity, error) {
+			return newWeatherObservedEntity(measurepoint, ws.wind)
+		}, "measurepoint", measurepoint.ID)
+	}
+
+	batch.Add(ws.retireMissingStations(ctx, now, inactive)...)
+
+	publishErrors, err := batch.Publish(ctx, ws.publisher)
+
+	// stations that have been marked inactive are forgotten until they are returned by the API again
+	for entityID, measurepointID := range inactive {
+		if _, failed := publishErrors[entityID]; !failed {
+			delete(ws.stations, measurepointID)
+			stationsChanged = true
 		}
 	}
 
-	return answer.Response.Result[0].Info.LastChangeID, nil
+	if err != nil {
+		return trafikverket.Info{}, err
+	}
+
+	if stationsChanged {
+		ws.saveStations(ctx)
+	}
+
+	return answer.Response.Result[0].Info, nil
+}
+
+// station is what is known about a measurepoint that has been returned by the Trafikverket API, and that
+// has not been marked inactive
+type station struct {
+	Position string `json:"position"`
+	// Seen is when the measurepoint was last returned by the Trafikverket API
+	Seen time.Time `json:"seen"`
+}
+
+// stationsKey is the key of the stations of the service in the checkpoint store
+func (ws *weatherSvc) stationsKey() string {
+	return ws.name + ":stations"
+}
+
+// loadStations reads the stations that were known when the service was last stopped, if they are kept
+func (ws *weatherSvc) loadStations(ctx context.Context) {
+	if ws.checkpoints == nil || ws.retireAfter <= 0 {
+		return
+	}
+
+	logger := logging.GetFromContext(ctx)
+
+	stored, err := ws.checkpoints.Get(ctx, ws.stationsKey())
+	if err != nil {
+		if !errors.Is(err, checkpoint.ErrNotFound) {
+			logger.Error("failed to load known weathermeasurepoints", "err", err.Error())
+		}
+		return
+	}
+
+	stations := map[string]station{}
+	err = json.Unmarshal([]byte(stored), &stations)
+	if err != nil {
+		logger.Error("failed to parse known weathermeasurepoints, they will not be retired until they are returned again", "err", err.Error())
+		return
+	}
+
+	ws.stations = stations
+}
+
+// saveStations keeps the known stations in the checkpoint store, if they should be kept
+func (ws *weatherSvc) saveStations(ctx context.Context) {
+	if ws.checkpoints == nil || ws.retireAfter <= 0 {
+		return
+	}
+
+	b, err := json.Marshal(ws.stations)
+	if err == nil {
+		err = ws.checkpoints.Set(ctx, ws.stationsKey(), string(b))
+	}
+	if err != nil {
+		logging.GetFromContext(ctx).Error("failed to store known weathermeasurepoints", "err", err.Error())
+	}
+}
+
+// retireMissingStations returns entities that mark the stations that have not been returned by the
+// Trafikverket API for longer than the retirement age as inactive, and adds them to inactive
+func (ws *weatherSvc) retireMissingStations(ctx context.Context, now time.Time, inactive map[string]string) []publisher.Entity {
+	retired := []publisher.Entity{}
+
+	if ws.retireAfter <= 0 {
+		return retired
+	}
+
+	for id, s := range ws.stations {
+		if now.Sub(s.Seen) < ws.retireAfter {
+			continue
+		}
+
+		logging.GetFromContext(ctx).Info("retiring weathermeasurepoint that has not been seen for a while", "measurepoint", id, "lastSeen", s.Seen.Format(time.RFC3339))
+
+		entity := newInactiveWeatherObservedEntity(id, s.Position)
+		inactive[entity.ID] = id
+		retired = append(retired, entity)
+	}
+
+	return retired
 }
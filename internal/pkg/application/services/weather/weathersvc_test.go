@@ -2,7 +2,9 @@ package weathersvc
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/diwise/context-broker/pkg/ngsild/types"
 	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
 	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/checkpoint"
 	httptest "github.com/diwise/service-chassis/pkg/test/http"
 	"github.com/diwise/service-chassis/pkg/test/http/expects"
 	"github.com/diwise/service-chassis/pkg/test/http/response"
@@ -28,6 +31,107 @@ func TestWeather(t *testing.T) {
 	is.Equal(len(ctxbroker.CreateEntityCalls()), 19) // create should equal the merge attempts, as each weathermeasurepoint is unknown
 }
 
+func TestStationsWithoutAirObservationsArePublished(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[
+		{"Id":"2214100","Name":"2214 Kävstabron Fjärryta","Geometry":{"WGS84":"POINT (17.12206 62.55289)"},
+		"Observation":{"Surface":{"Temperature":{"Value":-1.2}}},"ModifiedTime":"2024-10-16T20:41:47.184Z"}]}]}}`))
+	is.NoErr(err)
+
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 1)
+	is.NoErr(entities.ValidateFragmentAttributes(
+		ctxbroker.MergeEntityCalls()[0].Fragment,
+		map[string]any{"roadSurfaceTemperature": -1.2, "status": "active"},
+	))
+
+	ctxbroker.MergeEntityCalls()[0].Fragment.ForEachAttribute(func(_, name string, _ any) {
+		is.True(name != "temperature") // a value that is not reported should not be published
+	})
+}
+
+func TestDeletedStationsAreMarkedInactive(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	deleted := []byte(`{"RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[
+		{"Id":"2202","Deleted":true,"ModifiedTime":"2024-10-17T08:00:00.000Z"}]}]}}`)
+
+	ws.stations["2202"] = station{Position: "POINT (17.34482 62.43064)"}
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), deleted)
+	is.NoErr(err)
+
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 1)
+	is.Equal(ctxbroker.MergeEntityCalls()[0].EntityID, "urn:ngsi-ld:WeatherObserved:se:trafikverket:api:weathermeasurepoint:2202")
+	is.NoErr(entities.ValidateFragmentAttributes(ctxbroker.MergeEntityCalls()[0].Fragment, map[string]any{"status": "inactive"}))
+
+	_, known := ws.stations["2202"]
+	is.True(!known) // a station that has been marked inactive should be forgotten
+}
+
+func TestStationsThatAreNotSeenAreRetired(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	RetireAfter(time.Hour)(ws)
+	ws.stations["2212"] = station{Position: "POINT (16.87648 62.37616)", Seen: time.Now().Add(-2 * time.Hour)}
+	ws.stations["2213"] = station{Position: "POINT (17.04746 62.36276)", Seen: time.Now().Add(-10 * time.Minute)}
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[]}]}}`))
+	is.NoErr(err)
+
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 1)
+	is.Equal(ctxbroker.MergeEntityCalls()[0].EntityID, "urn:ngsi-ld:WeatherObserved:se:trafikverket:api:weathermeasurepoint:2212")
+	is.NoErr(entities.ValidateFragmentAttributes(ctxbroker.MergeEntityCalls()[0].Fragment, map[string]any{"status": "inactive"}))
+	_, known := ws.stations["2212"]
+	is.True(!known)
+}
+
+func TestStationsThatGoMissingDuringARestartAreRetired(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	ctx := context.Background()
+	store := checkpoint.NewMemoryStore()
+	is.NoErr(store.Set(ctx, "weather:stations", `{"2212":{"position":"POINT (16.87648 62.37616)","seen":"2024-10-16T20:41:47Z"}}`))
+
+	RetireAfter(time.Hour)(ws)
+	Checkpoints(store)(ws)
+	ws.loadStations(ctx)
+
+	_, err := ws.publishWeatherMeasurepoints(ctx, []byte(`{"RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[
+		{"Id":"2213","Name":"Ön","Geometry":{"WGS84":"POINT (17.04746 62.36276)"},"ModifiedTime":"2024-10-17T08:00:00.000Z"}]}]}}`))
+	is.NoErr(err)
+
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 2)
+	is.Equal(ctxbroker.MergeEntityCalls()[1].EntityID, "urn:ngsi-ld:WeatherObserved:se:trafikverket:api:weathermeasurepoint:2212") // a station known before the restart should be retired
+	is.NoErr(entities.ValidateFragmentAttributes(ctxbroker.MergeEntityCalls()[1].Fragment, map[string]any{"status": "inactive"}))
+
+	stored, err := store.Get(ctx, "weather:stations")
+	is.NoErr(err)
+
+	stations := map[string]station{}
+	is.NoErr(json.Unmarshal([]byte(stored), &stations))
+	is.Equal(len(stations), 1)
+	is.Equal(stations["2213"].Position, "POINT (17.04746 62.36276)") // the stations should be kept in the checkpoint store
+}
+
+func TestMeasurepointsThatCanNotBeConvertedDoNotHoldBackTheChangeID(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	info, err := ws.publishWeatherMeasurepoints(context.Background(), []byte(`{"RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[
+		{"Id":"2202","Name":"Råsta","Geometry":{"WGS84":"POINT (17.34482"},"ModifiedTime":"2024-10-16T20:41:47.131Z"},
+		{"Id":"2212","Name":"Nedansjö","Geometry":{"WGS84":"POINT (16.87648 62.37616)"},"ModifiedTime":"2024-10-16T20:41:47.134Z"}
+	],"INFO":{"LASTCHANGEID":"7426477292097896709"}}]}}`))
+
+	is.NoErr(err)
+	is.Equal(info.LastChangeID, "7426477292097896709") // the change id should advance past the measurepoint with an invalid position
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 1)
+}
+
 func TestGetWeatherMeasurepointStatus(t *testing.T) {
 	is, _, ws, ms := setupMockWeatherService(t, http.StatusOK, responseJSON)
 	defer ms.Close()
@@ -51,22 +155,11 @@ func TestPublishWeatherMeasurepointStatus(t *testing.T) {
 	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
 	defer ms.Close()
 
-	tm, _ := time.Parse(time.RFC3339, "2020-03-16T08:15:50.156Z")
-
-	weather := weatherMeasurepoint{
-		ID:           "123",
-		Name:         "ABC",
-		Geometry:     geometry{Position: "POINT (17.345039367675781 62.276519775390625)"},
-		ModifiedTime: tm,
-		Observation: observation{
-			Air: &air{
-				Temperature:      osv{"", "", 12.0},
-				RelativeHumidity: osv{"", "", 86.5},
-			},
-		},
-	}
-
-	_ = ws.publishWeatherMeasurepointStatus(context.Background(), weather)
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), measurepointsResponse(`{"Id":"123","Name":"ABC",
+		"Geometry":{"WGS84":"POINT (17.345039367675781 62.276519775390625)"},
+		"Observation":{"Air":{"Temperature":{"Value":12.0},"RelativeHumidity":{"Value":86.5}}},
+		"ModifiedTime":"2020-03-16T08:15:50.156Z"}`))
+	is.NoErr(err)
 
 	is.Equal(len(ctxbroker.MergeEntityCalls()), 1) // assert that we have a call to apply expectations on
 	is.NoErr(entities.ValidateFragmentAttributes(
@@ -75,26 +168,149 @@ func TestPublishWeatherMeasurepointStatus(t *testing.T) {
 	))
 }
 
-func TestPublishWeatherMeasurepointConvertsTimeProperly(t *testing.T) {
+func TestPublishWeatherMeasurepointWithRoadSurfaceAndPrecipitation(t *testing.T) {
 	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
 	defer ms.Close()
 
-	tm, _ := time.Parse(time.RFC3339, "2020-03-16T09:10:00.000+01:00")
-
-	weather := weatherMeasurepoint{
-		ID:           "123",
-		Name:         "ABC",
-		Geometry:     geometry{Position: "POINT (17.345039367675781 62.276519775390625)"},
-		ModifiedTime: tm.UTC(),
-		Observation: observation{
-			Air: &air{
-				Temperature:      osv{"", "", 12.0},
-				RelativeHumidity: osv{"", "", 92.0},
-			},
+	measurepoint := measurepointsResponse(`{"Id":"2202","Name":"Råsta","Geometry":{"WGS84":"POINT (17.34482 62.43064)"},
+		"Observation":{"Air":{"Temperature":{"Value":0.4},"RelativeHumidity":{"Value":91},"Dewpoint":{"Value":-0.9},"VisibleDistance":{"Value":2500}},
+		"Surface":{"Temperature":{"Value":-1.2},"Grip":{"Value":0.4}},"Weather":{"Precipitation":"snow"},
+		"Aggregated10minutes":{"Precipitation":{"TotalWaterEquivalent":{"Value":0.3}},"Wind":{"SpeedMax":{"Value":11.5}}}},
+		"ModifiedTime":"2024-10-16T20:41:47.131Z"}`)
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), measurepoint)
+	is.NoErr(err)
+
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 1)
+	is.NoErr(entities.ValidateFragmentAttributes(
+		ctxbroker.MergeEntityCalls()[0].Fragment,
+		map[string]any{
+			"temperature":            0.4,
+			"dewPoint":               -0.9,
+			"visibility":             2500.0,
+			"precipitation":          0.3,
+			"precipitationType":      "snow",
+			"gustSpeed":              11.5,
+			"roadSurfaceTemperature": -1.2,
+			"grip":                   0.4,
 		},
+	))
+}
+
+func TestPublishWeatherMeasurepointWithSensorProvenance(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	measurepoint := measurepointsResponse(`{"Id":"2202","Name":"Råsta","Geometry":{"WGS84":"POINT (17.34482 62.43064)"},
+		"Observation":{"Sample":"2024-10-16T22:40:03.001+02:00",
+		"Air":{"Temperature":{"Origin":"measured","SensorNames":"PT100","Value":0.4},"RelativeHumidity":{"Value":91},"Dewpoint":{"Origin":"calculated","Value":-0.9}}},
+		"ModifiedTime":"2024-10-16T20:41:47.131Z"}`)
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), measurepoint)
+	is.NoErr(err)
+
+	is.Equal(len(ctxbroker.MergeEntityCalls()), 1)
+	b, err := ctxbroker.MergeEntityCalls()[0].Fragment.MarshalJSON()
+	is.NoErr(err)
+
+	type text struct {
+		Value string `json:"value"`
 	}
+	type number struct {
+		Value      float64 `json:"value"`
+		ObservedAt string  `json:"observedAt"`
+		SensorName *text   `json:"sensorName"`
+		Origin     *text   `json:"origin"`
+	}
+	fragment := struct {
+		Temperature number `json:"temperature"`
+		Humidity    number `json:"humidity"`
+		DewPoint    number `json:"dewPoint"`
+	}{}
+	is.NoErr(json.Unmarshal(b, &fragment))
 
-	_ = ws.publishWeatherMeasurepointStatus(context.Background(), weather)
+	is.Equal(fragment.Temperature.Value, 0.4)
+	is.Equal(fragment.Temperature.ObservedAt, "2024-10-16T20:40:03Z") // measurements should be observed at the sample time
+	is.Equal(fragment.Temperature.SensorName.Value, "PT100")
+	is.Equal(fragment.Temperature.Origin.Value, "measured")
+	is.Equal(fragment.DewPoint.Origin.Value, "calculated")
+	is.True(fragment.DewPoint.SensorName == nil) // unknown sensor names should be left out
+	is.True(fragment.Humidity.Origin == nil)     // a value without provenance should be a plain number
+	is.Equal(fragment.Humidity.ObservedAt, "2024-10-16T20:40:03Z")
+}
+
+func TestPublishWeatherMeasurepointWithSeveralWindSensors(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	measurepoint := measurepointsResponse(`{"Id":"2202","Name":"Råsta","Geometry":{"WGS84":"POINT (17.34482 62.43064)"},
+		"Observation":{"Wind":[{"Direction":{"Value":155},"Height":2},{"Direction":{"Value":160},"Speed":{"Value":3.5},"Height":6},
+		{"Direction":{"Value":170},"Speed":{"Value":5.5},"Height":10}],
+		"Aggregated10minutes":{"Wind":{"SpeedAverage":{"Value":4.9},"SpeedMax":{"Value":11.5}}}},
+		"ModifiedTime":"2024-10-16T20:41:47.131Z"}`)
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), measurepoint)
+	is.NoErr(err)
+
+	is.NoErr(entities.ValidateFragmentAttributes(
+		ctxbroker.MergeEntityCalls()[0].Fragment,
+		map[string]any{"windDirection": 160.0, "windSpeed": 3.5, "averageWindSpeed": 4.9, "gustSpeed": 11.5},
+	)) // the first sensor with both direction and speed should be published by default
+
+	Wind(WindSensors{Heights: []float64{10}, Aggregate: true})(ws)
+	_, err = ws.publishWeatherMeasurepoints(context.Background(), measurepoint)
+	is.NoErr(err)
+
+	is.NoErr(entities.ValidateFragmentAttributes(
+		ctxbroker.MergeEntityCalls()[1].Fragment,
+		map[string]any{"windDirection": 170.0, "windSpeed": 5.5},
+	))
+
+	b, err := ctxbroker.MergeEntityCalls()[1].Fragment.MarshalJSON()
+	is.NoErr(err)
+
+	type calculated struct {
+		Value  float64 `json:"value"`
+		Origin struct {
+			Value string `json:"value"`
+		} `json:"origin"`
+	}
+	fragment := struct {
+		Mean calculated `json:"windSpeedSensorMean"`
+		Max  calculated `json:"windSpeedSensorMax"`
+	}{}
+	is.NoErr(json.Unmarshal(b, &fragment))
+
+	is.Equal(fragment.Mean.Value, 4.5)
+	is.Equal(fragment.Max.Value, 5.5)
+	is.Equal(fragment.Mean.Origin.Value, "calculated")
+}
+
+func TestPrimaryWindSensorByName(t *testing.T) {
+	is := is.New(t)
+
+	sensors := []wind{
+		{Direction: &osv{SensorNames: "Vaisala"}, Speed: &osv{SensorNames: "Vaisala", Value: 1}},
+		{Direction: &osv{SensorNames: "DSW, Lufft"}, Speed: &osv{SensorNames: "DSW, Lufft", Value: 2}},
+	}
+
+	w, ok := WindSensors{Names: []string{"lufft"}, Heights: []float64{10}}.primary(sensors)
+	is.True(ok)
+	is.Equal(w.Speed.Value, 2.0)
+
+	_, ok = WindSensors{}.primary([]wind{{Speed: &osv{Value: 1}}})
+	is.True(!ok) // a sensor without direction can not be the primary sensor
+}
+
+func TestPublishWeatherMeasurepointConvertsTimeProperly(t *testing.T) {
+	is, ctxbroker, ws, ms := setupMockWeatherService(t, 0, "")
+	defer ms.Close()
+
+	_, err := ws.publishWeatherMeasurepoints(context.Background(), measurepointsResponse(`{"Id":"123","Name":"ABC",
+		"Geometry":{"WGS84":"POINT (17.345039367675781 62.276519775390625)"},
+		"Observation":{"Air":{"Temperature":{"Value":12.0},"RelativeHumidity":{"Value":92.0}}},
+		"ModifiedTime":"2020-03-16T09:10:00.000+01:00"}`))
+	is.NoErr(err)
 
 	is.NoErr(entities.ValidateFragmentAttributes(
 		ctxbroker.CreateEntityCalls()[0].Entity,
@@ -126,4 +342,9 @@ func setupMockWeatherService(t *testing.T, tfvStatusCode int, tfvBody string) (*
 	return is, ctxBroker, ws.(*weatherSvc), tfvMock
 }
 
+// measurepointsResponse wraps the JSON of measurepoints in a response from the Trafikverket API
+func measurepointsResponse(measurepoints ...string) []byte {
+	return []byte(`{"RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[` + strings.Join(measurepoints, ",") + `]}]}}`)
+}
+
 const responseJSON string = `{ "RESPONSE":{"RESULT":[{"WeatherMeasurepoint":[{"Id":"2202","Name":"Råsta", "Geometry":{"WGS84":"POINT (17.34482 62.43064)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":2.8}, "RelativeHumidity":{"Value":91}},"Wind":[{ "Direction":{"Value":155}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:41:47.131Z"},{"Id":"2212","Name":"Nedansjö", "Geometry":{"WGS84":"POINT (16.87648 62.37616)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":0.8}, "RelativeHumidity":{"Value":98.3}},"Wind":[{ "Direction":{"Value":16}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:41:47.134Z"},{"Id":"2213","Name":"Vattjom", "Geometry":{"WGS84":"POINT (17.04746 62.36276)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":0.9}, "RelativeHumidity":{"Value":97.4}},"Wind":[{ "Direction":{"Value":211}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:41:47.137Z"},{"Id":"2214","Name":"Kävstabron", "Geometry":{"WGS84":"POINT (17.12191 62.55283)"}, "Observation":{"Sample":"2024-10-16T22:40:03.000+02:00", "Air":{ "Temperature":{"Value":0.3}, "RelativeHumidity":{"Value":98.6}},"Wind":[{ "Direction":{"Value":215}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:41:47.140Z"},{"Id":"2214100","Name":"2214 Kävstabron Fjärryta", "Geometry":{"WGS84":"POINT (17.12206 62.55289)"}, "Observation":{"Sample":"2024-10-16T22:40:03.000+02:00", "Air":{},"Wind":[{}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:41:47.184Z"},{"Id":"2115","Name":"Gryttjesjön", "Geometry":{"WGS84":"POINT (17.27754 62.0778)"}, "Observation":{"Sample":"2024-10-16T22:40:03.000+02:00", "Air":{ "Temperature":{"Value":2.6}, "RelativeHumidity":{"Value":94.6}},"Wind":[{ "Direction":{"Value":233}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.043Z"},{"Id":"2128","Name":"Norrhög", "Geometry":{"WGS84":"POINT (15.67114 62.26322)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":3.3}, "RelativeHumidity":{"Value":89}},"Wind":[{ "Direction":{"Value":163}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.068Z"},{"Id":"2129","Name":"Furuberg", "Geometry":{"WGS84":"POINT (16.56565 62.07392)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":4.2}, "RelativeHumidity":{"Value":86.5}},"Wind":[{ "Direction":{"Value":231}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.071Z"},{"Id":"2201","Name":"Armsjön", "Geometry":{"WGS84":"POINT (17.36961 62.19534)"}, "Observation":{"Sample":"2024-10-16T22:40:03.000+02:00", "Air":{ "Temperature":{"Value":4.9}, "RelativeHumidity":{"Value":87.6}},"Wind":[{ "Direction":{"Value":125}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.094Z"},{"Id":"2204","Name":"Högsnäs", "Geometry":{"WGS84":"POINT (17.70954 62.56162)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":1.7}, "RelativeHumidity":{"Value":98.5}},"Wind":[{ "Direction":{"Value":101}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.096Z"},{"Id":"2216","Name":"Timrå", "Geometry":{"WGS84":"POINT (17.3137 62.47091)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":-1.1}, "RelativeHumidity":{"Value":98.6}},"Wind":[{ "Direction":{"Value":255}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.103Z"},{"Id":"2221","Name":"Deltavägen", "Geometry":{"WGS84":"POINT (17.45301 62.51646)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":0.6}, "RelativeHumidity":{"Value":99.8}},"Wind":[{ "Direction":{"Value":332}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.127Z"},{"Id":"2226","Name":"Tälje", "Geometry":{"WGS84":"POINT (15.85131 62.55525)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":-1.1}, "RelativeHumidity":{"Value":99}},"Wind":[{ "Direction":{"Value":314}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.138Z"},{"Id":"2241","Name":"Torpshammar", "Geometry":{"WGS84":"POINT (16.36673 62.4734)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":-1.5}, "RelativeHumidity":{"Value":99.7}},"Wind":[{ "Direction":{"Value":87}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.168Z"},{"Id":"2245","Name":"Ljungan", "Geometry":{"WGS84":"POINT (17.34481 62.27648)"}, "Observation":{"Sample":"2024-10-16T22:40:03.004+02:00", "Air":{ "Temperature":{"Value":1.3}, "RelativeHumidity":{"Value":98.9}},"Wind":[{ "Direction":{"Value":124}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:23.175Z"},{"Id":"2216100","Name":"2216 Timrå Fjärryta", "Geometry":{"WGS84":"POINT (17.31354 62.4709)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{},"Wind":[{}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:27.928Z"},{"Id":"2221100","Name":"2221 Deltavägen Fjärryta", "Geometry":{"WGS84":"POINT (17.4529 62.51641)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{},"Wind":[{}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:43:27.932Z"},{"Id":"2244","Name":"Sundsvall 2", "Geometry":{"WGS84":"POINT (17.34096 62.38865)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":5.3}, "RelativeHumidity":{"Value":80.3}},"Wind":[{ "Direction":{"Value":237}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:44:48.593Z"},{"Id":"7601","Name":"Ånge GBG", "Geometry":{"WGS84":"POINT (15.64424 62.52549)"}, "Observation":{"Sample":"2024-10-16T22:40:03.001+02:00", "Air":{ "Temperature":{"Value":5.6}, "RelativeHumidity":{"Value":74.5}},"Wind":[{ "Direction":{"Value":297}}]},"Deleted":false,"ModifiedTime":"2024-10-16T20:44:48.687Z"}], "INFO":{"LASTCHANGEID":"7426477292097896709"}}]}}`
@@ -0,0 +1,129 @@
+package weathersvc
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+)
+
+// WindSensors decides which of the wind sensors of a measurepoint is published as its wind direction and
+// speed, and whether the speeds of all of its sensors should be summarised
+type WindSensors struct {
+	// Names are the names of the preferred sensors, in order of priority
+	Names []string
+	// Heights are the preferred heights of the sensors in metres, in order of priority after Names
+	Heights []float64
+	// Aggregate publishes the mean and the max of the speeds of all sensors
+	Aggregate bool
+}
+
+// Wind replaces the default choice of wind sensor, which is the first that reports both direction and speed
+func Wind(sensors WindSensors) func(*weatherSvc) {
+	return func(ws *weatherSvc) {
+		ws.wind = sensors
+	}
+}
+
+// primary returns the sensor with the highest priority that reports both direction and speed, or the
+// first of them if none of the sensors are preferred
+func (s WindSensors) primary(sensors []wind) (wind, bool) {
+	best, bestRank := wind{}, -1
+
+	for _, w := range sensors {
+		if w.Direction == nil || w.Speed == nil {
+			continue
+		}
+
+		if r := s.rank(w); bestRank < 0 || r < bestRank {
+			best, bestRank = w, r
+		}
+	}
+
+	return best, bestRank >= 0
+}
+
+// rank returns the position of a sensor in the priority, where lower comes first
+func (s WindSensors) rank(w wind) int {
+	names := w.sensorNames()
+
+	for i, name := range s.Names {
+		if slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) }) {
+			return i
+		}
+	}
+
+	for i, height := range s.Heights {
+		if w.Height != nil && *w.Height == height {
+			return len(s.Names) + i
+		}
+	}
+
+	return len(s.Names) + len(s.Heights)
+}
+
+// sensorNames returns the names of the sensors that reported the speed, or the direction, of the wind
+func (w wind) sensorNames() []string {
+	reported := ""
+	if w.Speed != nil && w.Speed.SensorNames != "" {
+		reported = w.Speed.SensorNames
+	} else if w.Direction != nil {
+		reported = w.Direction.SensorNames
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(reported, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// windObservations returns the attributes for the wind direction and speed of the primary sensor, the
+// 10 minute average and gust speeds and, if enabled, the mean and max speeds of all sensors
+func (s WindSensors) windObservations(o observation, at string) []entities.EntityDecoratorFunc {
+	attributes := []entities.EntityDecoratorFunc{}
+
+	if w, ok := s.primary(o.Wind); ok {
+		attributes = append(attributes,
+			measurement("windDirection", *w.Direction, at),
+			measurement("windSpeed", *w.Speed, at),
+		)
+	}
+
+	if o.Aggregated10minutes != nil && o.Aggregated10minutes.Wind != nil {
+		if average := o.Aggregated10minutes.Wind.SpeedAverage; average != nil {
+			attributes = append(attributes, measurement("averageWindSpeed", *average, at))
+		}
+		if gust := o.Aggregated10minutes.Wind.SpeedMax; gust != nil {
+			attributes = append(attributes, measurement("gustSpeed", *gust, at))
+		}
+	}
+
+	if !s.Aggregate {
+		return attributes
+	}
+
+	speeds := []float64{}
+	for _, w := range o.Wind {
+		if w.Speed != nil {
+			speeds = append(speeds, w.Speed.Value)
+		}
+	}
+
+	if len(speeds) > 0 {
+		sum := 0.0
+		for _, speed := range speeds {
+			sum += speed
+		}
+
+		attributes = append(attributes,
+			measurement("windSpeedSensorMean", osv{Origin: "calculated", Value: sum / float64(len(speeds))}, at),
+			measurement("windSpeedSensorMax", osv{Origin: "calculated", Value: slices.Max(speeds)}, at),
+		)
+	}
+
+	return attributes
+}
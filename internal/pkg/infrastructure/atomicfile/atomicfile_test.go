@@ -0,0 +1,34 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestWriteFileReplacesContents(t *testing.T) {
+	is := is.New(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	is.NoErr(os.WriteFile(path, []byte("old"), 0600))
+
+	is.NoErr(WriteFile(path, []byte("new")))
+
+	b, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(b), "new")
+
+	entries, err := os.ReadDir(dir)
+	is.NoErr(err)
+	is.Equal(len(entries), 1) // the temporary file should be gone
+}
+
+func TestWriteFileFailsInMissingDirectory(t *testing.T) {
+	is := is.New(t)
+
+	err := WriteFile(filepath.Join(t.TempDir(), "missing", "state.json"), []byte("new"))
+	is.True(err != nil) // expected an error but got none
+}
@@ -0,0 +1,120 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/atomicfile"
+)
+
+var ErrNotFound = errors.New("checkpoint not found")
+
+// Store keeps track of the last successfully processed change id for each service and query, and of
+// any other state that a service needs to resume where it left off, such as the known weather stations
+type Store interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key, changeID string) error
+}
+
+// NewMemoryStore creates a Store that is lost when the process exits
+func NewMemoryStore() Store {
+	return &memoryStore{
+		checkpoints: map[string]string{},
+	}
+}
+
+type memoryStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]string
+}
+
+func (s *memoryStore) Get(_ context.Context, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changeID, ok := s.checkpoints[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return changeID, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, key, changeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[key] = changeID
+	return nil
+}
+
+// NewFileStore creates a Store that persists all checkpoints as JSON in a local file. The file
+// is read once on creation and rewritten atomically on every Set.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{
+		path: path,
+		memoryStore: memoryStore{
+			checkpoints: map[string]string{},
+		},
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint file: %s", err.Error())
+	}
+
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &s.checkpoints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse checkpoint file %s: %s", path, err.Error())
+		}
+	}
+
+	return s, nil
+}
+
+type fileStore struct {
+	memoryStore
+	path string
+}
+
+func (s *fileStore) Set(_ context.Context, key, changeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.checkpoints[key]
+	s.checkpoints[key] = changeID
+
+	err := s.write()
+	if err != nil {
+		if existed {
+			s.checkpoints[key] = previous
+		} else {
+			delete(s.checkpoints, key)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *fileStore) write() error {
+	b, err := json.MarshalIndent(s.checkpoints, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoints: %s", err.Error())
+	}
+
+	err = atomicfile.WriteFile(s.path, b)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint file: %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestFileStoreIsPersisted(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	store, err := NewFileStore(path)
+	is.NoErr(err)
+
+	_, err = store.Get(ctx, "weather:abc")
+	is.True(errors.Is(err, ErrNotFound))
+
+	is.NoErr(store.Set(ctx, "weather:abc", "7426311386101186961"))
+
+	reopened, err := NewFileStore(path)
+	is.NoErr(err)
+
+	changeID, err := reopened.Get(ctx, "weather:abc")
+	is.NoErr(err)
+	is.Equal(changeID, "7426311386101186961")
+}
+
+func TestFileStoreFailsOnCorruptFile(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	is.NoErr(os.WriteFile(path, []byte("{not json"), 0600))
+
+	_, err := NewFileStore(path)
+	is.True(err != nil) // expected an error but got none
+}
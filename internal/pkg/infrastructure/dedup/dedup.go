@@ -0,0 +1,257 @@
+// Package dedup remembers what has been published, so that entities that have not changed since they were
+// last published can be skipped.
+package dedup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/atomicfile"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+)
+
+// Cache keeps the hash of the contents of every published entity, by scope and key, for at most a TTL.
+// The number of hashes is bounded, and the oldest hashes are evicted first when there are too many of them.
+// A Cache is safe for concurrent use.
+type Cache struct {
+	ttl           time.Duration
+	maxEntries    int
+	flushInterval time.Duration
+	path          string
+	now           func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]map[string]entry
+	dirty   bool
+}
+
+type entry struct {
+	Hash       string    `json:"hash"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// NewCache creates a Cache that is lost when the process exits
+func NewCache(options ...func(*Cache)) *Cache {
+	c := &Cache{
+		ttl:           24 * time.Hour,
+		maxEntries:    100000,
+		flushInterval: time.Minute,
+		now:           time.Now,
+		entries:       map[string]map[string]entry{},
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// NewFileCache creates a Cache that is persisted as JSON in a local file. The file is read once on creation
+// and rewritten atomically whenever the Cache is flushed after it has changed, see Start.
+func NewFileCache(path string, options ...func(*Cache)) (*Cache, error) {
+	c := NewCache(options...)
+	c.path = path
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("failed to read dedup cache file: %s", err.Error())
+	}
+
+	if len(b) > 0 {
+		err = json.Unmarshal(b, &c.entries)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse dedup cache file %s: %s", path, err.Error())
+		}
+	}
+
+	return c, nil
+}
+
+// TTL replaces the default time of 24 hours that a hash is kept, after which the entity is published again
+// even if it has not changed
+func TTL(ttl time.Duration) func(*Cache) {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// MaxEntries replaces the default limit of 100000 hashes
+func MaxEntries(maxEntries int) func(*Cache) {
+	return func(c *Cache) {
+		c.maxEntries = max(maxEntries, 1)
+	}
+}
+
+// FlushInterval replaces the default interval of one minute between flushes of a started Cache
+func FlushInterval(interval time.Duration) func(*Cache) {
+	return func(c *Cache) {
+		c.flushInterval = interval
+	}
+}
+
+// Start flushes the Cache every flush interval, and a last time when ctx is done
+func (c *Cache) Start(ctx context.Context) (chan struct{}, error) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		logger := logging.GetFromContext(ctx)
+		ticker := time.NewTicker(c.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				if err := c.Flush(); err != nil {
+					logger.Error("failed to flush dedup cache", "err", err.Error())
+				}
+				return
+			case <-ticker.C:
+				if err := c.Flush(); err != nil {
+					logger.Error("failed to flush dedup cache", "err", err.Error())
+				}
+			}
+		}
+	}()
+
+	return done, nil
+}
+
+// Changed returns false if hash was recorded for key within scope, and has not expired
+func (c *Cache) Changed(scope, key, hash string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[scope][key]
+	return !ok || e.Hash != hash || c.expired(e)
+}
+
+// Record remembers hash as the contents that were last published for key within scope
+func (c *Cache) Record(scope, key, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[scope]; !ok {
+		c.entries[scope] = map[string]entry{}
+	}
+
+	c.entries[scope][key] = entry{Hash: hash, RecordedAt: c.now()}
+	c.dirty = true
+}
+
+// Forget removes every hash within scope, so that all of its entities are published again
+func (c *Cache) Forget(scope string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[scope]; ok {
+		delete(c.entries, scope)
+		c.dirty = true
+	}
+}
+
+// ForgetKey removes the hash of key within every scope, so that the entity is published again
+func (c *Cache) ForgetKey(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for scope, entries := range c.entries {
+		if _, ok := entries[key]; ok {
+			delete(entries, key)
+			c.dirty = true
+		}
+
+		if len(entries) == 0 {
+			delete(c.entries, scope)
+		}
+	}
+}
+
+// Flush evicts expired hashes, and the oldest hashes if there are too many of them, and writes the Cache
+// to its file, if any, if it has changed since it was last written
+func (c *Cache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evict()
+
+	if c.path == "" || !c.dirty {
+		return nil
+	}
+
+	err := c.write()
+	if err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
+func (c *Cache) expired(e entry) bool {
+	return c.ttl > 0 && c.now().Sub(e.RecordedAt) >= c.ttl
+}
+
+func (c *Cache) evict() {
+	type recorded struct {
+		scope, key string
+		at         time.Time
+	}
+
+	remaining := []recorded{}
+
+	for scope, entries := range c.entries {
+		for key, e := range entries {
+			if c.expired(e) {
+				delete(entries, key)
+				c.dirty = true
+				continue
+			}
+			remaining = append(remaining, recorded{scope, key, e.RecordedAt})
+		}
+
+		if len(entries) == 0 {
+			delete(c.entries, scope)
+		}
+	}
+
+	if len(remaining) <= c.maxEntries {
+		return
+	}
+
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].at.Before(remaining[j].at) })
+
+	for _, r := range remaining[:len(remaining)-c.maxEntries] {
+		delete(c.entries[r.scope], r.key)
+		if len(c.entries[r.scope]) == 0 {
+			delete(c.entries, r.scope)
+		}
+	}
+
+	c.dirty = true
+}
+
+func (c *Cache) write() error {
+	b, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dedup cache: %s", err.Error())
+	}
+
+	err = atomicfile.WriteFile(c.path, b)
+	if err != nil {
+		return fmt.Errorf("failed to write dedup cache file: %s", err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package dedup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestHashesExpire(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now()
+	cache := NewCache(TTL(time.Hour))
+	cache.now = func() time.Time { return now }
+
+	is.True(cache.Changed("weather", "2202", "abc"))
+
+	cache.Record("weather", "2202", "abc")
+	is.True(!cache.Changed("weather", "2202", "abc"))
+	is.True(cache.Changed("weather", "2202", "def"))
+	is.True(cache.Changed("cameras", "2202", "abc")) // hashes should be kept apart by scope
+
+	now = now.Add(time.Hour)
+	is.True(cache.Changed("weather", "2202", "abc"))
+
+	is.NoErr(cache.Flush())
+	is.Equal(len(cache.entries), 0) // expired hashes should be evicted
+}
+
+func TestOldestHashesAreEvicted(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now()
+	cache := NewCache(MaxEntries(2))
+	cache.now = func() time.Time { return now }
+
+	for _, key := range []string{"1", "2", "3"} {
+		cache.Record("weather", key, "abc")
+		now = now.Add(time.Second)
+	}
+
+	is.NoErr(cache.Flush())
+
+	is.True(cache.Changed("weather", "1", "abc"))
+	is.True(!cache.Changed("weather", "2", "abc"))
+	is.True(!cache.Changed("weather", "3", "abc"))
+}
+
+func TestFileCacheIsPersisted(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "published.json")
+
+	cache, err := NewFileCache(path)
+	is.NoErr(err)
+
+	cache.Record("weather", "2202", "abc")
+	is.NoErr(cache.Flush())
+
+	reopened, err := NewFileCache(path)
+	is.NoErr(err)
+	is.True(!reopened.Changed("weather", "2202", "abc"))
+}
+
+func TestStartedCacheIsFlushedWhenStopped(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "published.json")
+
+	cache, err := NewFileCache(path, FlushInterval(time.Hour))
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, err := cache.Start(ctx)
+	is.NoErr(err)
+
+	cache.Record("weather", "2202", "abc")
+	cancel()
+	<-done
+
+	reopened, err := NewFileCache(path)
+	is.NoErr(err)
+	is.True(!reopened.Changed("weather", "2202", "abc")) // hashes should be written when the cache is stopped
+}
+
+func TestFileCacheFailsOnCorruptFile(t *testing.T) {
+	is := is.New(t)
+
+	path := filepath.Join(t.TempDir(), "published.json")
+	is.NoErr(os.WriteFile(path, []byte("{not json"), 0600))
+
+	_, err := NewFileCache(path)
+	is.True(err != nil) // expected an error but got none
+}
@@ -0,0 +1,370 @@
+package geometry
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidWKT = errors.New("invalid wkt")
+
+// Geometry is one of Point, LineString, MultiPoint, MultiLineString or Polygon
+type Geometry interface {
+	// Type returns the GeoJSON type name of the geometry, such as "LineString"
+	Type() string
+	// First returns the first point of the geometry, for consumers that can only handle points
+	First() Point
+}
+
+// Point is a position given as X (longitude or easting), Y (latitude or northing) and an optional Z
+type Point struct {
+	X, Y, Z float64
+}
+
+type LineString []Point
+type MultiPoint []Point
+type MultiLineString []LineString
+
+// Polygon is a list of linear rings, where the first is the exterior ring and any following rings are holes
+type Polygon []LineString
+
+func (p Point) Type() string             { return "Point" }
+func (ls LineString) Type() string       { return "LineString" }
+func (mp MultiPoint) Type() string       { return "MultiPoint" }
+func (mls MultiLineString) Type() string { return "MultiLineString" }
+func (p Polygon) Type() string           { return "Polygon" }
+
+func (p Point) First() Point             { return p }
+func (ls LineString) First() Point       { return ls[0] }
+func (mp MultiPoint) First() Point       { return mp[0] }
+func (mls MultiLineString) First() Point { return mls[0][0] }
+func (p Polygon) First() Point           { return p[0][0] }
+
+// Coordinates returns the point as [x, y], leaving out the Z value as GeoJSON consumers seldom expect it
+func (p Point) Coordinates() []float64 {
+	return []float64{p.X, p.Y}
+}
+
+func (ls LineString) Coordinates() [][]float64 {
+	coords := make([][]float64, 0, len(ls))
+	for _, p := range ls {
+		coords = append(coords, p.Coordinates())
+	}
+	return coords
+}
+
+func (mp MultiPoint) Coordinates() [][]float64 {
+	return LineString(mp).Coordinates()
+}
+
+func (mls MultiLineString) Coordinates() [][][]float64 {
+	coords := make([][][]float64, 0, len(mls))
+	for _, ls := range mls {
+		coords = append(coords, ls.Coordinates())
+	}
+	return coords
+}
+
+func (p Polygon) Coordinates() [][][]float64 {
+	return MultiLineString(p).Coordinates()
+}
+
+// Contains returns true if pt is inside the exterior ring of the polygon, but not inside any of its holes
+func (p Polygon) Contains(pt Point) bool {
+	if len(p) == 0 || !p[0].encloses(pt) {
+		return false
+	}
+
+	for _, hole := range p[1:] {
+		if hole.encloses(pt) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// encloses tells if pt is inside the linear ring ls, by counting how many of its edges a ray from pt crosses
+func (ls LineString) encloses(pt Point) bool {
+	inside := false
+
+	for i, j := 0, len(ls)-1; i < len(ls); j, i = i, i+1 {
+		a, b := ls[i], ls[j]
+		if (a.Y > pt.Y) != (b.Y > pt.Y) && pt.X < (b.X-a.X)*(pt.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// Parse parses a WKT geometry, such as
+//
+//	POINT (17.3058 62.3908)
+//	POINT Z (17.3058 62.3908 0)
+//	LINESTRING (17.3058 62.3908, 17.3121 62.3953)
+//	MULTIPOINT ((17.3058 62.3908), (17.3121 62.3953))
+//	MULTILINESTRING ((17.3058 62.3908, 17.3121 62.3953), (17.32 62.4, 17.33 62.41))
+//	POLYGON ((17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.2))
+func Parse(wkt string) (Geometry, error) {
+	p := &parser{wkt: wkt}
+
+	tag := strings.ToUpper(p.word())
+	if tag == "" {
+		return nil, fmt.Errorf("%w: missing geometry type in %q", ErrInvalidWKT, wkt)
+	}
+
+	dimension := strings.ToUpper(p.word())
+	switch dimension {
+	case "", "Z", "M", "ZM":
+	case "EMPTY":
+		return nil, fmt.Errorf("%w: empty geometry %q", ErrInvalidWKT, wkt)
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q after %s", ErrInvalidWKT, dimension, tag)
+	}
+	p.measured = strings.Contains(dimension, "M")
+
+	if strings.ToUpper(p.word()) == "EMPTY" {
+		return nil, fmt.Errorf("%w: empty geometry %q", ErrInvalidWKT, wkt)
+	}
+
+	var g Geometry
+	var err error
+
+	switch tag {
+	case "POINT":
+		var points []Point
+		points, err = p.points()
+		if err == nil && len(points) != 1 {
+			err = fmt.Errorf("%w: a point must have exactly one position", ErrInvalidWKT)
+		}
+		if err == nil {
+			g = points[0]
+		}
+	case "LINESTRING":
+		var ls LineString
+		ls, err = p.lineString()
+		g = ls
+	case "MULTIPOINT":
+		var mp MultiPoint
+		mp, err = p.multiPoint()
+		g = mp
+	case "MULTILINESTRING":
+		var mls MultiLineString
+		mls, err = p.lineStrings(2, false)
+		g = mls
+	case "POLYGON":
+		var rings MultiLineString
+		rings, err = p.lineStrings(4, true)
+		g = Polygon(rings)
+	default:
+		return nil, fmt.Errorf("%w: unsupported geometry type %s", ErrInvalidWKT, tag)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipSpace(); p.pos < len(p.wkt) {
+		return nil, fmt.Errorf("%w: unexpected %q at end of %s", ErrInvalidWKT, p.wkt[p.pos:], tag)
+	}
+
+	return g, nil
+}
+
+// ParsePoint parses a WKT POINT, or returns an error if the geometry is of another type
+func ParsePoint(wkt string) (Point, error) {
+	g, err := Parse(wkt)
+	if err != nil {
+		return Point{}, err
+	}
+
+	p, ok := g.(Point)
+	if !ok {
+		return Point{}, fmt.Errorf("%w: expected a point but got a %s", ErrInvalidWKT, g.Type())
+	}
+
+	return p, nil
+}
+
+type parser struct {
+	wkt      string
+	pos      int
+	measured bool
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.wkt) && strings.ContainsRune(" \t\r\n", rune(p.wkt[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.wkt) {
+		return p.wkt[p.pos]
+	}
+	return 0
+}
+
+// word consumes a run of letters, such as a geometry type, or returns "" without consuming anything
+func (p *parser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.wkt) && (p.wkt[p.pos]|0x20) >= 'a' && (p.wkt[p.pos]|0x20) <= 'z' {
+		p.pos++
+	}
+	return p.wkt[start:p.pos]
+}
+
+func (p *parser) expect(c byte) error {
+	if p.peek() != c {
+		if p.pos >= len(p.wkt) {
+			return fmt.Errorf("%w: expected '%c' but reached end of input", ErrInvalidWKT, c)
+		}
+		return fmt.Errorf("%w: expected '%c' at position %d", ErrInvalidWKT, c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+// point parses a position of two to four space separated numbers
+func (p *parser) point() (Point, error) {
+	values := []float64{}
+
+	for {
+		p.skipSpace()
+		start := p.pos
+		for p.pos < len(p.wkt) && !strings.ContainsRune(" \t\r\n,()", rune(p.wkt[p.pos])) {
+			p.pos++
+		}
+
+		if start == p.pos {
+			break
+		}
+
+		v, err := strconv.ParseFloat(p.wkt[start:p.pos], 64)
+		if err != nil {
+			return Point{}, fmt.Errorf("%w: invalid coordinate %q", ErrInvalidWKT, p.wkt[start:p.pos])
+		}
+		values = append(values, v)
+	}
+
+	if len(values) < 2 || len(values) > 4 {
+		return Point{}, fmt.Errorf("%w: a position must have two to four coordinates, got %d", ErrInvalidWKT, len(values))
+	}
+
+	pt := Point{X: values[0], Y: values[1]}
+	if len(values) > 2 && !(p.measured && len(values) == 3) {
+		pt.Z = values[2]
+	}
+
+	return pt, nil
+}
+
+// points parses a parenthesized, comma separated, list of positions
+func (p *parser) points() ([]Point, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	points := []Point{}
+
+	for {
+		pt, err := p.point()
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, pt)
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	return points, p.expect(')')
+}
+
+func (p *parser) lineString() (LineString, error) {
+	points, err := p.points()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(points) < 2 {
+		return nil, fmt.Errorf("%w: a linestring must have at least two positions", ErrInvalidWKT)
+	}
+
+	return points, nil
+}
+
+// multiPoint accepts both MULTIPOINT ((1 2), (3 4)) and the common MULTIPOINT (1 2, 3 4)
+func (p *parser) multiPoint() (MultiPoint, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	mp := MultiPoint{}
+
+	for {
+		if p.peek() == '(' {
+			points, err := p.points()
+			if err != nil {
+				return nil, err
+			}
+			if len(points) != 1 {
+				return nil, fmt.Errorf("%w: a point must have exactly one position", ErrInvalidWKT)
+			}
+			mp = append(mp, points[0])
+		} else {
+			pt, err := p.point()
+			if err != nil {
+				return nil, err
+			}
+			mp = append(mp, pt)
+		}
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	return mp, p.expect(')')
+}
+
+// lineStrings parses a parenthesized list of linestrings, or polygon rings if closed is true, that must
+// have at least minPoints positions each
+func (p *parser) lineStrings(minPoints int, closed bool) (MultiLineString, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	mls := MultiLineString{}
+
+	for {
+		points, err := p.points()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(points) < minPoints {
+			return nil, fmt.Errorf("%w: expected at least %d positions but got %d", ErrInvalidWKT, minPoints, len(points))
+		}
+
+		if closed && points[0] != points[len(points)-1] {
+			return nil, fmt.Errorf("%w: polygon ring is not closed", ErrInvalidWKT)
+		}
+
+		mls = append(mls, points)
+
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+
+	return mls, p.expect(')')
+}
@@ -0,0 +1,92 @@
+package geometry
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/matryer/is"
+)
+
+func TestParseSupportedGeometries(t *testing.T) {
+	is := is.New(t)
+
+	testCases := map[string]Geometry{
+		"POINT (17.345039367675781 62.276519775390625)": Point{X: 17.345039367675781, Y: 62.276519775390625},
+		"POINT Z (17.3058 62.3908 12.5)":                Point{X: 17.3058, Y: 62.3908, Z: 12.5},
+		"point(17.3058 62.3908)":                        Point{X: 17.3058, Y: 62.3908},
+		"LINESTRING (17.3058 62.3908, 17.3121 62.3953)": LineString{{X: 17.3058, Y: 62.3908}, {X: 17.3121, Y: 62.3953}},
+		"MULTIPOINT ((17.3 62.3), (17.4 62.4))":         MultiPoint{{X: 17.3, Y: 62.3}, {X: 17.4, Y: 62.4}},
+		"MULTIPOINT (17.3 62.3, 17.4 62.4)":             MultiPoint{{X: 17.3, Y: 62.3}, {X: 17.4, Y: 62.4}},
+		"MULTILINESTRING ((17.3 62.3, 17.4 62.4), (17.5 62.5, 17.6 62.6))": MultiLineString{
+			{{X: 17.3, Y: 62.3}, {X: 17.4, Y: 62.4}},
+			{{X: 17.5, Y: 62.5}, {X: 17.6, Y: 62.6}},
+		},
+		"POLYGON ((17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.2))": Polygon{
+			{{X: 17.1, Y: 62.2}, {X: 17.5, Y: 62.2}, {X: 17.5, Y: 62.5}, {X: 17.1, Y: 62.2}},
+		},
+	}
+
+	for wkt, expected := range testCases {
+		g, err := Parse(wkt)
+		is.NoErr(err)
+		is.Equal(g, expected) // unexpected geometry
+	}
+}
+
+func TestParseInvalidGeometries(t *testing.T) {
+	is := is.New(t)
+
+	invalid := []string{
+		"",
+		"POINT",
+		"POINT (",
+		"POINT ()",
+		"POINT (17.3058)",
+		"POINT (17.3058 north)",
+		"POINT (17.3 62.3, 17.4 62.4)",
+		"POINT EMPTY",
+		"POINT (17.3 62.3) trailing",
+		"LINESTRING (17.3 62.3)",
+		"MULTILINESTRING (17.3 62.3, 17.4 62.4)",
+		"POLYGON ((17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.3))",
+		"CIRCULARSTRING (17.1 62.2, 17.5 62.2, 17.5 62.5)",
+	}
+
+	for _, wkt := range invalid {
+		_, err := Parse(wkt)
+		is.True(errors.Is(err, ErrInvalidWKT)) // expected an ErrInvalidWKT
+	}
+
+	_, err := ParsePoint("LINESTRING (17.3 62.3, 17.4 62.4)")
+	is.True(errors.Is(err, ErrInvalidWKT)) // a linestring is not a point
+}
+
+func TestLocationOfMultiLineString(t *testing.T) {
+	is := is.New(t)
+
+	g, err := Parse("MULTILINESTRING ((17.3 62.3, 17.4 62.4), (17.5 62.5, 17.6 62.6))")
+	is.NoErr(err)
+
+	e, err := entities.New("urn:ngsi-ld:RoadWork:1", "RoadWork", Location(g))
+	is.NoErr(err)
+
+	b, err := json.Marshal(e)
+	is.NoErr(err)
+	is.True(strings.Contains(string(b), `"location":{"type":"GeoProperty","value":{"type":"MultiLineString","coordinates":[[[17.3,62.3],[17.4,62.4]],[[17.5,62.5],[17.6,62.6]]]}}`))
+}
+
+func TestPolygonContainsPoint(t *testing.T) {
+	is := is.New(t)
+
+	polygon := Polygon{
+		{{X: 17.0, Y: 62.0}, {X: 18.0, Y: 62.0}, {X: 18.0, Y: 63.0}, {X: 17.0, Y: 63.0}, {X: 17.0, Y: 62.0}},
+		{{X: 17.4, Y: 62.4}, {X: 17.6, Y: 62.4}, {X: 17.6, Y: 62.6}, {X: 17.4, Y: 62.6}, {X: 17.4, Y: 62.4}},
+	}
+
+	is.True(polygon.Contains(Point{X: 17.2, Y: 62.2}))
+	is.True(!polygon.Contains(Point{X: 17.5, Y: 62.5})) // a point in a hole should not be contained
+	is.True(!polygon.Contains(Point{X: 16.5, Y: 62.5}))
+}
@@ -0,0 +1,59 @@
+package geometry
+
+import (
+	"github.com/diwise/context-broker/pkg/ngsild/geojson"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/context-broker/pkg/ngsild/types/properties"
+)
+
+// Location returns a decorator that sets the location of an entity to g, which must be given in WGS84
+func Location(g Geometry) entities.EntityDecoratorFunc {
+	switch v := g.(type) {
+	case Point:
+		return decorators.Location(v.Y, v.X)
+	case LineString:
+		return decorators.LocationLS(v.Coordinates())
+	case MultiPoint:
+		return location(g, v.Coordinates())
+	case MultiLineString:
+		return location(g, v.Coordinates())
+	case Polygon:
+		return location(g, v.Coordinates())
+	}
+
+	return decorators.NoOp()
+}
+
+// location wraps the geometry types that lack a constructor in the geojson package
+func location(g Geometry, coordinates any) entities.EntityDecoratorFunc {
+	return entities.P(properties.Location, &geojson.GeoJSONProperty{
+		PropertyImpl: geojson.PropertyImpl{Type: "GeoProperty"},
+		Val: &geoJSONGeometry{
+			Type:        g.Type(),
+			Coordinates: coordinates,
+			first:       g.First(),
+		},
+	})
+}
+
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+	first       Point
+}
+
+func (g *geoJSONGeometry) GeoPropertyType() string {
+	return g.Type
+}
+
+func (g *geoJSONGeometry) GeoPropertyValue() geojson.GeoJSONGeometry {
+	return g
+}
+
+func (g *geoJSONGeometry) GetAsPoint() geojson.GeoJSONPropertyPoint {
+	return geojson.GeoJSONPropertyPoint{
+		Type:        "Point",
+		Coordinates: [2]float64{g.first.X, g.first.Y},
+	}
+}
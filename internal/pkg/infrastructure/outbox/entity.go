@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+)
+
+// encodeEntity marshals an entity to the same NGSI-LD representation that is sent to the context broker
+func encodeEntity(e publisher.Entity) (json.RawMessage, error) {
+	entity, err := entities.New(e.ID, e.Type, e.Attributes...)
+	if err != nil {
+		return nil, fmt.Errorf("entities.New failed: %s", err.Error())
+	}
+
+	b, err := entity.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal entity: %s", err.Error())
+	}
+
+	return b, nil
+}
+
+// decodeEntity restores an entity that was marshalled by encodeEntity. The attributes are kept in their
+// marshalled form, rather than parsed into properties, so that the entity is published exactly as it was
+// before it was stored.
+func decodeEntity(body json.RawMessage) (publisher.Entity, error) {
+	contents := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &contents)
+	if err != nil {
+		return publisher.Entity{}, fmt.Errorf("failed to unmarshal entity: %s", err.Error())
+	}
+
+	e := publisher.Entity{}
+	json.Unmarshal(contents["id"], &e.ID)
+	json.Unmarshal(contents["type"], &e.Type)
+
+	if e.ID == "" || e.Type == "" {
+		return publisher.Entity{}, fmt.Errorf("entity is missing an id or type")
+	}
+
+	if ctx, ok := contents["@context"]; ok {
+		jsonldContext := []string{}
+		err = json.Unmarshal(ctx, &jsonldContext)
+		if err != nil {
+			return publisher.Entity{}, fmt.Errorf("unsupported context: %s", string(ctx))
+		}
+		e.Attributes = append(e.Attributes, entities.Context(jsonldContext))
+	}
+
+	delete(contents, "id")
+	delete(contents, "type")
+	delete(contents, "@context")
+
+	for name, value := range contents {
+		attribute := rawAttribute{body: value}
+		err = json.Unmarshal(value, &attribute.header)
+		if err != nil {
+			return publisher.Entity{}, fmt.Errorf("failed to unmarshal attribute %s: %s", name, err.Error())
+		}
+
+		if attribute.Type() == "Relationship" {
+			e.Attributes = append(e.Attributes, entities.R(name, attribute))
+		} else {
+			e.Attributes = append(e.Attributes, entities.P(name, attribute))
+		}
+	}
+
+	return e, nil
+}
+
+// rawAttribute is a property or relationship that is marshalled exactly as it was read
+type rawAttribute struct {
+	header struct {
+		Type   string `json:"type"`
+		Value  any    `json:"value"`
+		Object any    `json:"object"`
+	}
+	body json.RawMessage
+}
+
+func (a rawAttribute) Type() string {
+	return a.header.Type
+}
+
+func (a rawAttribute) Value() any {
+	return a.header.Value
+}
+
+func (a rawAttribute) Object() any {
+	return a.header.Object
+}
+
+func (a rawAttribute) MarshalJSON() ([]byte, error) {
+	return a.body, nil
+}
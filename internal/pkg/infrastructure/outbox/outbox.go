@@ -0,0 +1,612 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/atomicfile"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var ErrClosed = errors.New("outbox is closed")
+
+// Outbox is a Publisher that stores entities on disk before they are delivered to the context broker,
+// so that observations are not lost while the broker is unavailable or the service is restarted.
+// Entities are delivered in the background once the outbox has been started.
+type Outbox interface {
+	publisher.Publisher
+	Start(ctx context.Context) (chan struct{}, error)
+	Delivery() Delivery
+}
+
+// Delivery is how well entities are being delivered from an Outbox to the context broker
+type Delivery struct {
+	Pending          int
+	OldestPendingAge time.Duration
+	// LastDelivery is when an entity was last delivered
+	LastDelivery time.Time
+	// ConsecutiveFailures is the number of attempts in a row that did not deliver any entity
+	ConsecutiveFailures int
+	LastError           string
+}
+
+// NewFileOutbox creates an Outbox that appends pending entities, and delivery receipts, to the file at path
+// and delivers them using the given publisher. Entities that were still pending when the file was last
+// written are delivered again once the outbox is started.
+func NewFileOutbox(path string, delivery publisher.Publisher, options ...func(*outbox)) (Outbox, error) {
+	o := &outbox{
+		path:           path,
+		delivery:       delivery,
+		initialBackoff: 1 * time.Second,
+		maxBackoff:     5 * time.Minute,
+		maxAttempts:    20,
+		compactAfter:   1000,
+		wakeup:         make(chan struct{}, 1),
+	}
+
+	for _, option := range options {
+		option(o)
+	}
+
+	err := o.load()
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.compact()
+	if err != nil {
+		return nil, err
+	}
+
+	err = o.registerMetrics()
+	if err != nil {
+		o.file.Close()
+		return nil, fmt.Errorf("failed to register outbox metrics: %s", err.Error())
+	}
+
+	return o, nil
+}
+
+// Backoff sets the delay before the first retry after a failed delivery of an entity, and the maximum
+// delay that it is doubled up to while deliveries of the entity keep failing
+func Backoff(initial, max time.Duration) func(*outbox) {
+	return func(o *outbox) {
+		o.initialBackoff = initial
+		o.maxBackoff = max
+	}
+}
+
+// MaxAttempts replaces the default of 20 attempts to deliver an entity before it is dropped, so that
+// an entity that is rejected by the context broker does not hold back later updates to it forever
+func MaxAttempts(attempts int) func(*outbox) {
+	return func(o *outbox) {
+		o.maxAttempts = max(attempts, 1)
+	}
+}
+
+// OnDrop is called with every entity that is dropped after too many failed deliveries, such as to forget
+// that it was published
+func OnDrop(onDrop func(ctx context.Context, e publisher.Entity)) func(*outbox) {
+	return func(o *outbox) {
+		o.onDrop = onDrop
+	}
+}
+
+type pendingEntity struct {
+	seq        uint64
+	enqueuedAt time.Time
+	entity     publisher.Entity
+
+	// attempts and retryAt are kept in memory only, so every entity gets all of its attempts after a restart
+	attempts int
+	retryAt  time.Time
+}
+
+type outbox struct {
+	path     string
+	delivery publisher.Publisher
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	maxAttempts    int
+	compactAfter   int
+	onDrop         func(ctx context.Context, e publisher.Entity)
+
+	mu        sync.Mutex
+	file      *os.File
+	closed    bool
+	seq       uint64
+	pending   []pendingEntity
+	delivered int
+
+	lastDelivery        time.Time
+	consecutiveFailures int
+	lastError           string
+
+	wakeup  chan struct{}
+	dropped metric.Int64Counter
+}
+
+// record is a line in the outbox file. A record either adds an entity to the outbox or marks
+// a previously added entity, with the same sequence number, as delivered or dropped.
+type record struct {
+	Seq        uint64          `json:"seq"`
+	Delivered  bool            `json:"delivered,omitempty"`
+	EnqueuedAt *time.Time      `json:"enqueuedAt,omitempty"`
+	Tenant     string          `json:"tenant,omitempty"`
+	Entity     json.RawMessage `json:"entity,omitempty"`
+}
+
+func (o *outbox) Publish(ctx context.Context, entities ...publisher.Entity) map[string]error {
+	failures := map[string]error{}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		for _, e := range entities {
+			failures[e.ID] = ErrClosed
+		}
+		return failures
+	}
+
+	buf := &bytes.Buffer{}
+	added := []pendingEntity{}
+	now := time.Now().UTC()
+
+	for _, e := range entities {
+		body, err := encodeEntity(e)
+		if err != nil {
+			failures[e.ID] = err
+			continue
+		}
+
+		p := pendingEntity{seq: o.seq + uint64(len(added)) + 1, enqueuedAt: now, entity: e}
+		err = writeRecord(buf, record{Seq: p.seq, EnqueuedAt: &now, Tenant: e.Tenant, Entity: body})
+		if err != nil {
+			failures[e.ID] = err
+			continue
+		}
+
+		added = append(added, p)
+	}
+
+	if len(added) == 0 {
+		return failures
+	}
+
+	err := o.append(buf.Bytes())
+	if err != nil {
+		logging.GetFromContext(ctx).Error("failed to store entities in outbox", "err", err.Error())
+		for _, p := range added {
+			failures[p.entity.ID] = err
+		}
+		return failures
+	}
+
+	o.seq += uint64(len(added))
+	o.pending = append(o.pending, added...)
+
+	select {
+	case o.wakeup <- struct{}{}:
+	default:
+	}
+
+	return failures
+}
+
+func (o *outbox) Start(ctx context.Context) (chan struct{}, error) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer o.close()
+
+		logger := logging.GetFromContext(ctx)
+
+		for {
+			delivered, failed := o.deliver(ctx, time.Now())
+
+			if failed > 0 {
+				logger.Warn("failed to deliver entities from outbox, will retry", "failed", failed, "delivered", delivered)
+			}
+
+			if delivered > 0 {
+				// entities that were waiting behind the ones just delivered can be sent right away
+				continue
+			}
+
+			var retry <-chan time.Time
+			if next, ok := o.nextRetry(); ok {
+				retry = time.After(time.Until(next))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-retry:
+			case <-o.wakeup:
+			}
+		}
+	}()
+
+	return done, nil
+}
+
+// deliver publishes the oldest pending entity for each entity id, so that updates to the same entity are
+// delivered in the order they were added to the outbox, unless its delivery failed and it is waiting to be
+// retried. Entities that fail too many times are dropped. deliver returns the number of delivered and
+// failed entities.
+func (o *outbox) deliver(ctx context.Context, now time.Time) (int, int) {
+	logger := logging.GetFromContext(ctx)
+
+	o.mu.Lock()
+	heads := []pendingEntity{}
+	seen := map[string]bool{}
+	for _, p := range o.pending {
+		if !seen[p.entity.ID] {
+			seen[p.entity.ID] = true
+			if !now.Before(p.retryAt) {
+				heads = append(heads, p)
+			}
+		}
+	}
+	o.mu.Unlock()
+
+	if len(heads) == 0 {
+		return 0, 0
+	}
+
+	batch := make([]publisher.Entity, 0, len(heads))
+	for _, p := range heads {
+		batch = append(batch, p.entity)
+	}
+
+	failures := o.delivery.Publish(ctx, batch...)
+
+	droppedEntities := []publisher.Entity{}
+
+	// the dropped entities are passed on once the outbox has been unlocked
+	defer func() {
+		if o.onDrop != nil {
+			for _, e := range droppedEntities {
+				o.onDrop(ctx, e)
+			}
+		}
+	}()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	removed := map[uint64]bool{}
+	delivered, dropped := 0, 0
+
+	for _, p := range heads {
+		err, failed := failures[p.entity.ID]
+		if !failed {
+			writeRecord(buf, record{Seq: p.seq, Delivered: true})
+			removed[p.seq] = true
+			delivered++
+			continue
+		}
+
+		attempts := o.retry(p.seq, now)
+		if attempts >= o.maxAttempts {
+			logger.Error("dropping entity from outbox after too many failed deliveries", "id", p.entity.ID, "attempts", attempts, "err", err.Error())
+			writeRecord(buf, record{Seq: p.seq, Delivered: true})
+			removed[p.seq] = true
+			droppedEntities = append(droppedEntities, p.entity)
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		o.dropped.Add(ctx, int64(dropped))
+	}
+
+	if delivered > 0 {
+		o.lastDelivery = now
+		o.consecutiveFailures = 0
+		o.lastError = ""
+	} else {
+		o.consecutiveFailures++
+		for _, err := range failures {
+			o.lastError = err.Error()
+			break
+		}
+	}
+
+	if len(removed) == 0 {
+		return 0, len(failures)
+	}
+
+	err := o.append(buf.Bytes())
+	if err != nil {
+		// the entities will be delivered again, which is harmless since they are merged into the broker
+		logger.Error("failed to mark entities as delivered in outbox", "err", err.Error())
+	}
+
+	pending := make([]pendingEntity, 0, len(o.pending))
+	for _, p := range o.pending {
+		if !removed[p.seq] {
+			pending = append(pending, p)
+		}
+	}
+	o.pending = pending
+	o.delivered += len(removed)
+
+	if o.delivered >= o.compactAfter && o.delivered > len(o.pending) {
+		err = o.compact()
+		if err != nil {
+			logger.Error("failed to compact outbox", "err", err.Error())
+		}
+	}
+
+	return delivered, len(failures)
+}
+
+// retry records a failed delivery of the pending entity with the given sequence number, and when it may be
+// retried, and returns the number of failed attempts so far. The delay is doubled for every failed attempt.
+func (o *outbox) retry(seq uint64, now time.Time) int {
+	for i := range o.pending {
+		p := &o.pending[i]
+		if p.seq != seq {
+			continue
+		}
+
+		backoff := o.initialBackoff
+		for n := 0; n < p.attempts && backoff < o.maxBackoff; n++ {
+			backoff *= 2
+		}
+
+		p.attempts++
+		p.retryAt = now.Add(min(backoff, o.maxBackoff))
+
+		return p.attempts
+	}
+
+	return 0
+}
+
+// nextRetry returns the earliest time that a pending entity may be delivered, which is in the past for
+// entities that have not been attempted yet, if there are any pending entities
+func (o *outbox) nextRetry() (time.Time, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	next, found := time.Time{}, false
+	seen := map[string]bool{}
+
+	for _, p := range o.pending {
+		if seen[p.entity.ID] {
+			continue
+		}
+		seen[p.entity.ID] = true
+
+		if !found || p.retryAt.Before(next) {
+			next, found = p.retryAt, true
+		}
+	}
+
+	return next, found
+}
+
+// Delivery returns how well entities are being delivered to the context broker
+func (o *outbox) Delivery() Delivery {
+	pending, oldest := o.stats()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return Delivery{
+		Pending:             pending,
+		OldestPendingAge:    oldest,
+		LastDelivery:        o.lastDelivery,
+		ConsecutiveFailures: o.consecutiveFailures,
+		LastError:           o.lastError,
+	}
+}
+
+// stats returns the number of pending entities and the time since the oldest of them was added
+func (o *outbox) stats() (int, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.pending) == 0 {
+		return 0, 0
+	}
+
+	return len(o.pending), time.Since(o.pending[0].enqueuedAt)
+}
+
+func (o *outbox) registerMetrics() error {
+	meter := otel.Meter("outbox")
+
+	depth, err := meter.Int64ObservableGauge(
+		"outbox.pending",
+		metric.WithDescription("Number of entities waiting to be delivered to the context broker"),
+		metric.WithUnit("{entity}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	age, err := meter.Float64ObservableGauge(
+		"outbox.oldest_pending_age",
+		metric.WithDescription("Time since the oldest entity waiting to be delivered was added to the outbox"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	o.dropped, err = meter.Int64Counter(
+		"outbox.dropped",
+		metric.WithDescription("Number of entities that were dropped from the outbox after too many failed deliveries"),
+		metric.WithUnit("{entity}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, observer metric.Observer) error {
+		pending, oldest := o.stats()
+		observer.ObserveInt64(depth, int64(pending))
+		observer.ObserveFloat64(age, oldest.Seconds())
+		return nil
+	}, depth, age)
+
+	return err
+}
+
+// load reads the pending entities from the outbox file, if it exists. A last line that is not valid
+// JSON is assumed to be a write that was interrupted by a crash and is ignored.
+func (o *outbox) load() error {
+	f, err := os.Open(o.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open outbox file: %s", err.Error())
+	}
+	defer f.Close()
+
+	pending := map[uint64]pendingEntity{}
+	order := []uint64{}
+	reader := bufio.NewReader(f)
+
+	for lineNo := 1; ; lineNo++ {
+		line, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return fmt.Errorf("failed to read outbox file: %s", readErr.Error())
+		}
+
+		if len(bytes.TrimSpace(line)) > 0 {
+			r := record{}
+			err = json.Unmarshal(line, &r)
+			if err != nil {
+				if errors.Is(readErr, io.EOF) {
+					break
+				}
+				return fmt.Errorf("failed to parse line %d of outbox file %s: %s", lineNo, o.path, err.Error())
+			}
+
+			o.seq = max(o.seq, r.Seq)
+
+			if r.Delivered {
+				delete(pending, r.Seq)
+			} else {
+				e, err := decodeEntity(r.Entity)
+				if err != nil {
+					return fmt.Errorf("failed to decode entity on line %d of outbox file %s: %s", lineNo, o.path, err.Error())
+				}
+
+				e.Tenant = r.Tenant
+
+				p := pendingEntity{seq: r.Seq, entity: e}
+				if r.EnqueuedAt != nil {
+					p.enqueuedAt = *r.EnqueuedAt
+				}
+
+				pending[r.Seq] = p
+				order = append(order, r.Seq)
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+	}
+
+	for _, seq := range order {
+		if p, ok := pending[seq]; ok {
+			o.pending = append(o.pending, p)
+		}
+	}
+
+	return nil
+}
+
+// compact atomically replaces the outbox file with one that only contains the pending entities
+func (o *outbox) compact() error {
+	buf := &bytes.Buffer{}
+
+	for _, p := range o.pending {
+		body, err := encodeEntity(p.entity)
+		if err != nil {
+			return err
+		}
+
+		enqueuedAt := p.enqueuedAt
+		err = writeRecord(buf, record{Seq: p.seq, EnqueuedAt: &enqueuedAt, Tenant: p.entity.Tenant, Entity: body})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := atomicfile.WriteFile(o.path, buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write outbox file: %s", err.Error())
+	}
+
+	f, err := os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox file: %s", err.Error())
+	}
+
+	if o.file != nil {
+		o.file.Close()
+	}
+
+	o.file = f
+	o.delivered = 0
+
+	return nil
+}
+
+// append writes records to the end of the outbox file and waits for them to reach the disk
+func (o *outbox) append(b []byte) error {
+	if o.closed {
+		return ErrClosed
+	}
+
+	_, err := o.file.Write(b)
+	if err == nil {
+		err = o.file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write to outbox file: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (o *outbox) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.closed = true
+	o.file.Close()
+}
+
+func writeRecord(w io.Writer, r record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox record: %s", err.Error())
+	}
+
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,341 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/dedup"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/publisher"
+	"github.com/matryer/is"
+)
+
+func TestThatPendingEntitiesSurviveARestart(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	ob, err := NewFileOutbox(path, &publisherMock{})
+	is.NoErr(err)
+
+	failures := ob.Publish(context.Background(), testEntity("1", 7.0), testEntity("2", 8.0))
+	is.Equal(len(failures), 0)
+
+	pending, _ := ob.(*outbox).stats()
+	is.Equal(pending, 2)
+
+	reopened, err := NewFileOutbox(path, &publisherMock{})
+	is.NoErr(err)
+
+	pending, age := reopened.(*outbox).stats()
+	is.Equal(pending, 2)
+	is.True(age > 0)
+}
+
+func TestThatEntitiesAreDeliveredUnchanged(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	line, err := geometry.Parse("LINESTRING (17.3 62.4, 17.4 62.5)")
+	is.NoErr(err)
+
+	e := testEntity("1", 7.0)
+	e.Attributes = append(e.Attributes, geometry.Location(line), decorators.Status("on"))
+	e.Tenant = "sundsvall"
+	expected, err := encodeEntity(e)
+	is.NoErr(err)
+
+	ob, err := NewFileOutbox(path, &publisherMock{})
+	is.NoErr(err)
+	ob.Publish(context.Background(), e)
+
+	mock := &publisherMock{}
+	reopened, err := NewFileOutbox(path, mock)
+	is.NoErr(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, _ := reopened.Start(ctx)
+
+	published := mock.waitFor(t, 1)
+	cancel()
+	<-done
+
+	actual, err := encodeEntity(published[0])
+	is.NoErr(err)
+	is.Equal(published[0].ID, "urn:ngsi-ld:WeatherObserved:1")
+	is.Equal(published[0].Tenant, "sundsvall") // the tenant should be kept while the entity is pending
+	is.Equal(asMap(is, actual), asMap(is, expected))
+}
+
+func TestThatUpdatesToTheSameEntityAreDeliveredInOrder(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	mock := &publisherMock{failures: 2}
+	ob, err := NewFileOutbox(path, mock, Backoff(time.Millisecond, 5*time.Millisecond))
+	is.NoErr(err)
+
+	ob.Publish(context.Background(), testEntity("1", 1.0), testEntity("2", 1.0))
+	ob.Publish(context.Background(), testEntity("1", 2.0))
+	ob.Publish(context.Background(), testEntity("1", 3.0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, _ := ob.Start(ctx)
+
+	published := mock.waitFor(t, 4)
+	cancel()
+	<-done
+
+	temperatures := []float64{}
+	for _, e := range published {
+		if e.ID == "urn:ngsi-ld:WeatherObserved:1" {
+			b, _ := encodeEntity(e)
+			temperatures = append(temperatures, asMap(is, b)["temperature"].(map[string]any)["value"].(float64))
+		}
+	}
+
+	is.Equal(temperatures, []float64{1.0, 2.0, 3.0})
+
+	pending, _ := ob.(*outbox).stats()
+	is.Equal(pending, 0)
+
+	reopened, err := NewFileOutbox(path, &publisherMock{})
+	is.NoErr(err)
+
+	pending, _ = reopened.(*outbox).stats()
+	is.Equal(pending, 0) // delivered entities should not be delivered again after a restart
+}
+
+func TestThatARejectedEntityIsDroppedWithoutHoldingBackOthers(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	mock := &publisherMock{rejected: map[string]int{"urn:ngsi-ld:WeatherObserved:1": 3}}
+	ob, err := NewFileOutbox(path, mock, Backoff(time.Hour, time.Hour), MaxAttempts(3))
+	is.NoErr(err)
+
+	ob.Publish(context.Background(), testEntity("1", 1.0))
+	ob.Publish(context.Background(), testEntity("1", 2.0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, _ := ob.Start(ctx)
+
+	ob.Publish(context.Background(), testEntity("2", 1.0))
+	published := mock.waitFor(t, 1)
+	is.Equal(published[0].ID, "urn:ngsi-ld:WeatherObserved:2") // other entities should not wait for the backoff of a rejected one
+
+	// skip the backoff of the rejected entity instead of waiting for it
+	o := ob.(*outbox)
+	for left := 1; left >= 0; left-- {
+		o.mu.Lock()
+		for i := range o.pending {
+			o.pending[i].retryAt = time.Time{}
+		}
+		o.mu.Unlock()
+		o.wakeup <- struct{}{}
+		mock.waitForRejections(t, "urn:ngsi-ld:WeatherObserved:1", left)
+	}
+
+	published = mock.waitFor(t, 2)
+	cancel()
+	<-done
+
+	b, _ := encodeEntity(published[1])
+	is.Equal(published[1].ID, "urn:ngsi-ld:WeatherObserved:1")
+	is.Equal(asMap(is, b)["temperature"].(map[string]any)["value"].(float64), 2.0) // the rejected update should be dropped after 3 attempts
+
+	pending, _ := o.stats()
+	is.Equal(pending, 0)
+}
+
+func TestThatADroppedEntityIsPublishedAgain(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	cache := dedup.NewCache()
+	dropped := make(chan struct{}, 1)
+	forget := func(_ context.Context, e publisher.Entity) {
+		cache.ForgetKey(publisher.CacheKey(e))
+		dropped <- struct{}{}
+	}
+
+	mock := &publisherMock{rejected: map[string]int{"urn:ngsi-ld:WeatherObserved:1": 1}}
+	ob, err := NewFileOutbox(path, mock, MaxAttempts(1), OnDrop(forget))
+	is.NoErr(err)
+
+	pub := publisher.WithDeduplication(ob, cache, "weather")
+	is.Equal(len(pub.Publish(context.Background(), testEntity("1", 1.0))), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done, _ := ob.Start(ctx)
+
+	select {
+	case <-dropped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the entity to be dropped")
+	}
+
+	is.Equal(len(pub.Publish(context.Background(), testEntity("1", 1.0))), 0)
+
+	published := mock.waitFor(t, 1)
+	cancel()
+	<-done
+
+	is.Equal(published[0].ID, "urn:ngsi-ld:WeatherObserved:1") // the dropped entity should not be skipped as unchanged
+}
+
+func TestThatDeliveriesAreReported(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	ob, err := NewFileOutbox(path, &publisherMock{failures: 2}, Backoff(time.Millisecond, time.Millisecond))
+	is.NoErr(err)
+	o := ob.(*outbox)
+
+	ob.Publish(context.Background(), testEntity("1", 1.0))
+
+	now := time.Now()
+	o.deliver(context.Background(), now)
+	o.deliver(context.Background(), now.Add(time.Second))
+
+	delivery := ob.Delivery()
+	is.Equal(delivery.Pending, 1)
+	is.Equal(delivery.ConsecutiveFailures, 2)
+	is.Equal(delivery.LastError, "context broker unavailable")
+	is.True(delivery.LastDelivery.IsZero())
+
+	o.deliver(context.Background(), now.Add(2*time.Second))
+
+	delivery = ob.Delivery()
+	is.Equal(delivery.Pending, 0)
+	is.Equal(delivery.ConsecutiveFailures, 0)
+	is.Equal(delivery.LastDelivery, now.Add(2*time.Second))
+}
+
+func TestThatAnInterruptedWriteIsIgnored(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	ob, err := NewFileOutbox(path, &publisherMock{})
+	is.NoErr(err)
+	ob.Publish(context.Background(), testEntity("1", 7.0))
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	is.NoErr(err)
+	f.WriteString(`{"seq":2,"enqueuedAt":"2026-10`)
+	f.Close()
+
+	reopened, err := NewFileOutbox(path, &publisherMock{})
+	is.NoErr(err)
+
+	pending, _ := reopened.(*outbox).stats()
+	is.Equal(pending, 1)
+}
+
+func TestThatACorruptOutboxFileIsReported(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+
+	is.NoErr(os.WriteFile(path, []byte("{not json\n{\"seq\":1,\"delivered\":true}\n"), 0600))
+
+	_, err := NewFileOutbox(path, &publisherMock{})
+	is.True(err != nil) // expected an error but got none
+	is.True(strings.Contains(err.Error(), "line 1"))
+}
+
+func testEntity(id string, temperature float64) publisher.Entity {
+	return publisher.Entity{
+		ID:   "urn:ngsi-ld:WeatherObserved:" + id,
+		Type: "WeatherObserved",
+		Attributes: []entities.EntityDecoratorFunc{
+			decorators.Location(62.4, 17.3),
+			decorators.Number("temperature", temperature),
+			decorators.DateObserved("2026-10-17T08:00:00Z"),
+		},
+	}
+}
+
+func asMap(is *is.I, b []byte) map[string]any {
+	m := map[string]any{}
+	is.NoErr(json.Unmarshal(b, &m))
+	return m
+}
+
+// publisherMock fails the first failures calls to Publish, rejects an entity as many times as given by rejected,
+// and records the entities that are published
+type publisherMock struct {
+	mu        sync.Mutex
+	failures  int
+	rejected  map[string]int
+	published []publisher.Entity
+}
+
+func (m *publisherMock) Publish(_ context.Context, entities ...publisher.Entity) map[string]error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := map[string]error{}
+
+	if m.failures > 0 {
+		m.failures--
+		for _, e := range entities {
+			result[e.ID] = errors.New("context broker unavailable")
+		}
+		return result
+	}
+
+	for _, e := range entities {
+		if m.rejected[e.ID] > 0 {
+			m.rejected[e.ID]--
+			result[e.ID] = errors.New("bad request")
+			continue
+		}
+		m.published = append(m.published, e)
+	}
+
+	return result
+}
+
+// waitForRejections waits until an entity has no more than left rejections left
+func (m *publisherMock) waitForRejections(t *testing.T, id string, left int) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		rejected := m.rejected[id]
+		m.mu.Unlock()
+
+		if rejected <= left {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %s to be rejected", id)
+}
+
+func (m *publisherMock) waitFor(t *testing.T, count int) []publisher.Entity {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		if len(m.published) >= count {
+			published := append([]publisher.Entity{}, m.published...)
+			m.mu.Unlock()
+			return published
+		}
+		m.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %d published entities", count)
+	return nil
+}
@@ -0,0 +1,92 @@
+package publisher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+)
+
+// Cache remembers the hashes of the contents of published entities, see dedup.Cache
+type Cache interface {
+	Changed(scope, key, hash string) bool
+	Record(scope, key, hash string)
+}
+
+// WithDeduplication creates a Publisher that only passes the entities that have changed since they were last
+// published within scope, such as the name of a feed, on to next. An entity has changed if the hash of its
+// NGSI-LD representation, or its tenant, differs from the one recorded in cache. The hash is recorded as soon
+// as next accepts the entity, so a next that may give up on an entity later, such as an outbox, must make the
+// cache forget it by its CacheKey.
+func WithDeduplication(next Publisher, cache Cache, scope string) Publisher {
+	return &dedupPublisher{next: next, cache: cache, scope: scope}
+}
+
+type dedupPublisher struct {
+	next  Publisher
+	cache Cache
+	scope string
+}
+
+func (p *dedupPublisher) Publish(ctx context.Context, batch ...Entity) map[string]error {
+	changed := make([]Entity, 0, len(batch))
+	hashes := map[string]string{}
+
+	for _, e := range batch {
+		hash, err := hashOf(e)
+		if err != nil {
+			// entities that can not be hashed are left to fail, or not, when they are published
+			changed = append(changed, e)
+			continue
+		}
+
+		if !p.cache.Changed(p.scope, CacheKey(e), hash) {
+			continue
+		}
+
+		changed = append(changed, e)
+		hashes[e.ID] = hash
+	}
+
+	unchanged(ctx, p.scope, len(batch)-len(changed))
+
+	if len(changed) == 0 {
+		return map[string]error{}
+	}
+
+	failures := p.next.Publish(ctx, changed...)
+
+	for _, e := range changed {
+		if _, failed := failures[e.ID]; failed {
+			continue
+		}
+
+		if hash, ok := hashes[e.ID]; ok {
+			p.cache.Record(p.scope, CacheKey(e), hash)
+		}
+	}
+
+	return failures
+}
+
+// CacheKey returns the key that the hash of an entity is recorded by, within the scope of a deduplicating Publisher
+func CacheKey(e Entity) string {
+	return e.Tenant + "/" + e.ID
+}
+
+// hashOf returns the hash of the NGSI-LD representation of an entity, which has its attributes in a stable order
+func hashOf(e Entity) (string, error) {
+	entity, err := entities.New(e.ID, e.Type, e.Attributes...)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := entity.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
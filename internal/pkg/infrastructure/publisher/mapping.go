@@ -0,0 +1,94 @@
+package publisher
+
+import (
+	"context"
+	"strings"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+)
+
+// DefaultIDNamespace is the part of every entity id, following the urn:ngsi-ld:<type>: prefix, that
+// tells that the entity was created from the Trafikverket API
+const DefaultIDNamespace string = "se:trafikverket:api:"
+
+// Mapping describes how the entities of a feed are changed before they are published
+type Mapping struct {
+	// IDNamespace replaces DefaultIDNamespace in the id of every entity, if not empty
+	IDNamespace string
+	// Attributes renames properties, or removes them if they are mapped to an empty name
+	Attributes map[string]string
+}
+
+// WithMapping creates a Publisher that changes every entity according to mapping before it is published
+// by next. Errors are returned by the id of the entity before it was changed.
+func WithMapping(next Publisher, mapping Mapping) Publisher {
+	if mapping.IDNamespace == "" && len(mapping.Attributes) == 0 {
+		return next
+	}
+
+	return &mappingPublisher{next: next, mapping: mapping}
+}
+
+type mappingPublisher struct {
+	next    Publisher
+	mapping Mapping
+}
+
+func (p *mappingPublisher) Publish(ctx context.Context, batch ...Entity) map[string]error {
+	mapped := make([]Entity, 0, len(batch))
+	originalIDs := map[string]string{}
+
+	for _, e := range batch {
+		m := e
+
+		if p.mapping.IDNamespace != "" {
+			m.ID = strings.Replace(e.ID, DefaultIDNamespace, p.mapping.IDNamespace, 1)
+		}
+
+		if len(p.mapping.Attributes) > 0 {
+			m.Attributes = append(e.Attributes[:len(e.Attributes):len(e.Attributes)], renameAttributes(p.mapping.Attributes))
+		}
+
+		originalIDs[m.ID] = e.ID
+		mapped = append(mapped, m)
+	}
+
+	failures := map[string]error{}
+	for id, err := range p.next.Publish(ctx, mapped...) {
+		if originalID, ok := originalIDs[id]; ok {
+			id = originalID
+		}
+		failures[id] = err
+	}
+
+	return failures
+}
+
+// renameAttributes returns a decorator that must be applied after all other decorators of an entity, that
+// renames or removes the properties that have been added to the entity by them. Relationships are left as is.
+func renameAttributes(names map[string]string) entities.EntityDecoratorFunc {
+	return func(e *entities.EntityImpl) {
+		renamed := []entities.EntityDecoratorFunc{}
+
+		e.ForEachAttribute(func(attributeType, name string, contents any) {
+			newName, ok := names[name]
+			if !ok || newName == "" || attributeType == "Relationship" {
+				return
+			}
+
+			if property, ok := contents.(types.Property); ok {
+				renamed = append(renamed, entities.P(newName, property))
+			}
+		})
+
+		e.RemoveAttribute(func(attributeType, name string, _ any) bool {
+			_, ok := names[name]
+			return ok && attributeType != "Relationship"
+		})
+
+		for _, decorate := range renamed {
+			decorate(e)
+		}
+	}
+}
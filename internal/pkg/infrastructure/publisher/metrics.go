@@ -0,0 +1,67 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var brokerRequestDuration = newBrokerRequestDuration()
+
+func newBrokerRequestDuration() metric.Float64Histogram {
+	histogram, err := otel.Meter("context-broker-publisher").Float64Histogram(
+		"contextbroker.request.duration",
+		metric.WithDescription("Duration of requests to the context broker"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return histogram
+}
+
+// recordBrokerRequest records the duration of an operation, such as merge, create or upsert, on the context
+// broker and its outcome
+func recordBrokerRequest(ctx context.Context, operation string, start time.Time, outcome string) {
+	brokerRequestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("operation", operation),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// outcomeOf returns the outcome of an operation on the context broker that returned err
+func outcomeOf(err error) string {
+	if errors.Is(err, ngsierrors.ErrNotFound) {
+		return "not_found"
+	} else if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+var unchangedEntities = newUnchangedEntities()
+
+func newUnchangedEntities() metric.Int64Counter {
+	counter, err := otel.Meter("context-broker-publisher").Int64Counter(
+		"ingress.entities.unchanged",
+		metric.WithDescription("Entities that were not published since they had not changed since they were last published"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return counter
+}
+
+// unchanged records the number of entities of a service that were not published since they had not changed
+func unchanged(ctx context.Context, service string, count int) {
+	if count > 0 {
+		unchangedEntities.Add(ctx, int64(count), metric.WithAttributes(attribute.String("service", service)))
+	}
+}
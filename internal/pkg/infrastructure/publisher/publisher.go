@@ -0,0 +1,300 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/diwise/context-broker/pkg/ngsild/client"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/logging"
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+)
+
+// Entity is an entity to be created in, or merged into, the context broker
+type Entity struct {
+	ID         string
+	Type       string
+	Attributes []entities.EntityDecoratorFunc
+	// Tenant is the NGSI-LD tenant that the entity is published to, or the default tenant if empty
+	Tenant string
+	// Counties are the numbers of the counties that the entity is located in, if known, so that it can be
+	// routed to a tenant
+	Counties []string
+}
+
+type Publisher interface {
+	// Publish creates or updates the given entities and returns the errors, by entity id, of those
+	// that could not be published. The returned map is empty if all entities were published.
+	Publish(ctx context.Context, entities ...Entity) map[string]error
+}
+
+var tracer = otel.Tracer("context-broker-publisher")
+
+// NewPublisher creates a Publisher that merges each entity into the context broker, and creates it
+// if it does not exist, unless batch upserts are enabled with the BatchUpsert option
+func NewPublisher(ctxBroker client.ContextBrokerClient, options ...func(*publisher)) Publisher {
+	p := &publisher{
+		ctxBroker: ctxBroker,
+		httpClient: http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			Timeout:   30 * time.Second,
+		},
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+
+	return p
+}
+
+// BatchUpsert makes the Publisher send entities to the batch upsert endpoint of the context broker at
+// brokerURL, in chunks of at most chunkSize entities. If the broker does not support batch operations
+// the Publisher falls back to merging and creating one entity at a time.
+func BatchUpsert(brokerURL string, chunkSize int) func(*publisher) {
+	return func(p *publisher) {
+		p.brokerURL = strings.TrimSuffix(brokerURL, "/")
+		p.chunkSize = chunkSize
+	}
+}
+
+type publisher struct {
+	ctxBroker client.ContextBrokerClient
+
+	brokerURL        string
+	chunkSize        int
+	httpClient       http.Client
+	batchUnsupported atomic.Bool
+}
+
+var errBatchUnsupported = errors.New("context broker does not support batch operations")
+
+func (p *publisher) Publish(ctx context.Context, entities ...Entity) map[string]error {
+	failures := map[string]error{}
+
+	if p.chunkSize <= 0 || p.batchUnsupported.Load() {
+		p.publishOneByOne(ctx, entities, failures)
+		return failures
+	}
+
+	for _, tenantEntities := range byTenant(entities) {
+		for start := 0; start < len(tenantEntities); start += p.chunkSize {
+			chunk := tenantEntities[start:min(start+p.chunkSize, len(tenantEntities))]
+
+			if p.batchUnsupported.Load() {
+				p.publishOneByOne(ctx, chunk, failures)
+				continue
+			}
+
+			err := p.upsert(ctx, chunk, failures)
+			if errors.Is(err, errBatchUnsupported) {
+				logging.GetFromContext(ctx).Warn("batch upsert is not supported by the context broker, falling back to one entity at a time")
+				p.batchUnsupported.Store(true)
+				p.publishOneByOne(ctx, chunk, failures)
+				continue
+			}
+
+			if err != nil {
+				for _, e := range chunk {
+					failures[e.ID] = err
+				}
+			}
+		}
+	}
+
+	return failures
+}
+
+// byTenant groups entities by their tenant, since a batch operation can only target a single tenant
+func byTenant(entities []Entity) [][]Entity {
+	groups := [][]Entity{}
+	index := map[string]int{}
+
+	for _, e := range entities {
+		i, ok := index[e.Tenant]
+		if !ok {
+			i = len(groups)
+			index[e.Tenant] = i
+			groups = append(groups, []Entity{})
+		}
+		groups[i] = append(groups[i], e)
+	}
+
+	return groups
+}
+
+// headers returns the headers of a request to the context broker for entities of the given tenant
+func headers(tenant string) map[string][]string {
+	h := map[string][]string{"Content-Type": {"application/ld+json"}}
+	if tenant != "" {
+		h["NGSILD-Tenant"] = []string{tenant}
+	}
+	return h
+}
+
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+type batchOperationResult struct {
+	Success []string `json:"success"`
+	Errors  []struct {
+		EntityID string         `json:"entityId"`
+		Error    problemDetails `json:"error"`
+	} `json:"errors"`
+}
+
+// upsert sends a chunk of entities to the batch upsert endpoint and adds any per entity errors to failures
+func (p *publisher) upsert(ctx context.Context, chunk []Entity, failures map[string]error) error {
+	var err error
+	ctx, span := tracer.Start(ctx, "batch-upsert")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	body := make([]json.RawMessage, 0, len(chunk))
+
+	for _, e := range chunk {
+		var entity types.Entity
+		entity, err = entities.New(e.ID, e.Type, e.Attributes...)
+		if err != nil {
+			failures[e.ID] = fmt.Errorf("entities.New failed: %s", err.Error())
+			continue
+		}
+
+		b, err := entity.MarshalJSON()
+		if err != nil {
+			failures[e.ID] = fmt.Errorf("failed to marshal entity: %s", err.Error())
+			continue
+		}
+
+		body = append(body, b)
+	}
+
+	if len(body) == 0 {
+		return nil
+	}
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	// options=update merges attributes into existing entities, just like MergeEntity
+	url := p.brokerURL + "/ngsi-ld/v1/entityOperations/upsert?options=update"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(requestBody))
+	if err != nil {
+		err = fmt.Errorf("failed to create request: %s", err.Error())
+		return err
+	}
+
+	for key, values := range headers(chunk[0].Tenant) {
+		req.Header.Set(key, values[0])
+	}
+
+	start := time.Now()
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		recordBrokerRequest(ctx, "upsert", start, outcomeOf(err))
+		err = fmt.Errorf("batch upsert failed: %s", err.Error())
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		recordBrokerRequest(ctx, "upsert", start, "failure")
+	} else {
+		recordBrokerRequest(ctx, "upsert", start, "success")
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusNoContent:
+		return nil
+	case http.StatusMultiStatus:
+		result := batchOperationResult{}
+		err = json.Unmarshal(respBody, &result)
+		if err != nil {
+			err = fmt.Errorf("failed to parse batch operation result: %s", err.Error())
+			return err
+		}
+
+		for _, e := range result.Errors {
+			failures[e.EntityID] = fmt.Errorf("batch upsert failed: %s (%s)", e.Error.Title, e.Error.Detail)
+		}
+
+		return nil
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return errBatchUnsupported
+	}
+
+	err = fmt.Errorf("batch upsert failed with status code %d: %s", resp.StatusCode, string(respBody))
+	return err
+}
+
+func (p *publisher) publishOneByOne(ctx context.Context, entities []Entity, failures map[string]error) {
+	for _, e := range entities {
+		err := p.mergeOrCreate(ctx, e)
+		if err != nil {
+			failures[e.ID] = err
+		}
+	}
+}
+
+func (p *publisher) mergeOrCreate(ctx context.Context, e Entity) error {
+	var err error
+	ctx, span := tracer.Start(ctx, "merge-or-create")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	fragment, err := entities.NewFragment(e.Attributes...)
+	if err != nil {
+		err = fmt.Errorf("entities.NewFragment failed: %s", err.Error())
+		return err
+	}
+
+	headers := headers(e.Tenant)
+
+	start := time.Now()
+
+	_, err = p.ctxBroker.MergeEntity(ctx, e.ID, fragment, headers)
+	recordBrokerRequest(ctx, "merge", start, outcomeOf(err))
+	if err != nil {
+		if !errors.Is(err, ngsierrors.ErrNotFound) {
+			err = fmt.Errorf("failed to merge entity: %s", err.Error())
+			return err
+		}
+
+		var entity types.Entity
+		entity, err = entities.New(e.ID, e.Type, e.Attributes...)
+		if err != nil {
+			err = fmt.Errorf("entities.New failed: %s", err.Error())
+			return err
+		}
+
+		start = time.Now()
+
+		_, err = p.ctxBroker.CreateEntity(ctx, entity, headers)
+		recordBrokerRequest(ctx, "create", start, outcomeOf(err))
+		if err != nil {
+			err = fmt.Errorf("failed to post %s to context broker: %s", e.Type, err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
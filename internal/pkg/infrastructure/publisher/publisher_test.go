@@ -0,0 +1,291 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/diwise/context-broker/pkg/ngsild"
+	ngsierrors "github.com/diwise/context-broker/pkg/ngsild/errors"
+	"github.com/diwise/context-broker/pkg/ngsild/types"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities/decorators"
+	test "github.com/diwise/context-broker/pkg/test"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/dedup"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/matryer/is"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestThatEntitiesAreUpsertedInChunks(t *testing.T) {
+	is := is.New(t)
+
+	chunks := [][]map[string]any{}
+
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Path, "/ngsi-ld/v1/entityOperations/upsert")
+		is.Equal(r.URL.Query().Get("options"), "update")
+		is.Equal(r.Header.Get("Content-Type"), "application/ld+json")
+
+		body, _ := io.ReadAll(r.Body)
+		chunk := []map[string]any{}
+		is.NoErr(json.Unmarshal(body, &chunk))
+		chunks = append(chunks, chunk)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer broker.Close()
+
+	ctxBroker := &test.ContextBrokerClientMock{}
+	p := NewPublisher(ctxBroker, BatchUpsert(broker.URL, 2))
+
+	failures := p.Publish(context.Background(), testEntities("1", "2", "3")...)
+
+	is.Equal(len(failures), 0)
+	is.Equal(len(chunks), 2)
+	is.Equal(len(chunks[0]), 2)
+	is.Equal(chunks[1][0]["id"], "urn:ngsi-ld:WeatherObserved:3")
+	is.Equal(len(ctxBroker.MergeEntityCalls()), 0)
+}
+
+func TestThatPerEntityFailuresAreReported(t *testing.T) {
+	is := is.New(t)
+
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusMultiStatus)
+		w.Write([]byte(`{"success":["urn:ngsi-ld:WeatherObserved:1"],"errors":[{"entityId":"urn:ngsi-ld:WeatherObserved:2","error":{"type":"https://uri.etsi.org/ngsi-ld/errors/BadRequestData","title":"Bad request","detail":"invalid attribute"}}]}`))
+	}))
+	defer broker.Close()
+
+	p := NewPublisher(&test.ContextBrokerClientMock{}, BatchUpsert(broker.URL, 10))
+
+	failures := p.Publish(context.Background(), testEntities("1", "2")...)
+
+	is.Equal(len(failures), 1)
+	is.True(failures["urn:ngsi-ld:WeatherObserved:2"] != nil)
+}
+
+func TestThatTheOutcomeOfACreateIsRecordedOnTheSpan(t *testing.T) {
+	is := is.New(t)
+
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, ngsierrors.ErrNotFound
+		},
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			if entity.ID() == "urn:ngsi-ld:WeatherObserved:2" {
+				return nil, errors.New("bad request")
+			}
+			return nil, nil
+		},
+	}
+
+	failures := NewPublisher(ctxBroker).Publish(context.Background(), testEntities("1", "2")...)
+	is.Equal(len(failures), 1)
+
+	ended := spans.Ended()
+	is.Equal(len(ended), 2)
+	is.Equal(ended[0].Status().Code, codes.Unset) // a merge that is followed by a successful create is not an error
+	is.Equal(ended[1].Status().Code, codes.Error)
+	is.True(strings.Contains(ended[1].Status().Description, "bad request")) // the failed create should be recorded, not the missing entity
+}
+
+func TestFallbackWhenBatchOperationsAreNotSupported(t *testing.T) {
+	is := is.New(t)
+
+	batchRequests := 0
+
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		batchRequests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer broker.Close()
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		CreateEntityFunc: func(ctx context.Context, entity types.Entity, headers map[string][]string) (*ngsild.CreateEntityResult, error) {
+			return nil, nil
+		},
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, ngsierrors.ErrNotFound
+		},
+	}
+
+	p := NewPublisher(ctxBroker, BatchUpsert(broker.URL, 2))
+
+	failures := p.Publish(context.Background(), testEntities("1", "2", "3")...)
+	is.Equal(len(failures), 0)
+
+	failures = p.Publish(context.Background(), testEntities("4")...)
+	is.Equal(len(failures), 0)
+
+	is.Equal(batchRequests, 1) // should not try to batch again once the broker has reported that it is unsupported
+	is.Equal(len(ctxBroker.MergeEntityCalls()), 4)
+	is.Equal(len(ctxBroker.CreateEntityCalls()), 4)
+}
+
+func TestMappingRenamesIDsAndAttributes(t *testing.T) {
+	is := is.New(t)
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, errors.New("merge failed")
+		},
+	}
+
+	p := WithMapping(NewPublisher(ctxBroker), Mapping{
+		IDNamespace: "se:sundsvall:",
+		Attributes:  map[string]string{"name": "", "temperature": "airTemperature", "refDevice": "device"},
+	})
+
+	entity := Entity{
+		ID:   "urn:ngsi-ld:WeatherObserved:se:trafikverket:api:weathermeasurepoint:1",
+		Type: "WeatherObserved",
+		Attributes: []entities.EntityDecoratorFunc{
+			decorators.Name("1"),
+			decorators.Number("temperature", 2.8),
+			decorators.RefDevice("urn:ngsi-ld:Device:1"),
+		},
+	}
+
+	failures := p.Publish(context.Background(), entity)
+	is.True(failures[entity.ID] != nil) // failures should be reported by the original entity id
+
+	merge := ctxBroker.MergeEntityCalls()[0]
+	is.Equal(merge.EntityID, "urn:ngsi-ld:WeatherObserved:se:sundsvall:weathermeasurepoint:1")
+
+	b, _ := json.Marshal(merge.Fragment)
+	attributes := map[string]any{}
+	is.NoErr(json.Unmarshal(b, &attributes))
+
+	_, hasName := attributes["name"]
+	is.True(!hasName)
+	is.True(attributes["airTemperature"] != nil)
+	is.Equal(attributes["temperature"], nil)
+	is.True(attributes["refDevice"] != nil) // relationships should be left as is
+}
+
+func testEntities(ids ...string) []Entity {
+	result := []Entity{}
+
+	for _, id := range ids {
+		result = append(result, Entity{
+			ID:         "urn:ngsi-ld:WeatherObserved:" + id,
+			Type:       "WeatherObserved",
+			Attributes: []entities.EntityDecoratorFunc{decorators.Name(id)},
+		})
+	}
+
+	return result
+}
+
+func TestEntitiesAreRoutedToTenants(t *testing.T) {
+	is := is.New(t)
+
+	tenants := map[string][]string{}
+
+	broker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		chunk := []map[string]any{}
+		is.NoErr(json.Unmarshal(body, &chunk))
+
+		tenant := r.Header.Get("NGSILD-Tenant")
+		for _, e := range chunk {
+			tenants[tenant] = append(tenants[tenant], e["id"].(string))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer broker.Close()
+
+	p := WithTenants(NewPublisher(&test.ContextBrokerClientMock{}, BatchUpsert(broker.URL, 10)), Routing{
+		Tenant: "default",
+		Routes: []TenantRoute{
+			{Tenant: "jamtland", Counties: []string{"23"}},
+			{Tenant: "sundsvall", Area: geometry.Polygon{{{X: 17, Y: 62}, {X: 18, Y: 62}, {X: 18, Y: 63}, {X: 17, Y: 62}}}},
+		},
+	})
+
+	entity := func(id string, counties []string, lat, lon float64) Entity {
+		return Entity{
+			ID:         "urn:ngsi-ld:RoadAccident:" + id,
+			Type:       "RoadAccident",
+			Attributes: []entities.EntityDecoratorFunc{decorators.Location(lat, lon)},
+			Counties:   counties,
+		}
+	}
+
+	failures := p.Publish(context.Background(),
+		entity("1", []string{"23"}, 62.3, 17.9),
+		entity("2", []string{"22"}, 62.3, 17.9),
+		entity("3", nil, 59.3, 18.0),
+	)
+
+	is.Equal(len(failures), 0)
+	is.Equal(tenants["jamtland"], []string{"urn:ngsi-ld:RoadAccident:1"})
+	is.Equal(tenants["sundsvall"], []string{"urn:ngsi-ld:RoadAccident:2"}) // the location should be within the area of the route
+	is.Equal(tenants["default"], []string{"urn:ngsi-ld:RoadAccident:3"})
+}
+
+func TestTenantHeaderIsSetWhenMerging(t *testing.T) {
+	is := is.New(t)
+
+	ctxBroker := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			return nil, nil
+		},
+	}
+
+	entity := testEntities("1")[0]
+	entity.Tenant = "sundsvall"
+
+	failures := NewPublisher(ctxBroker).Publish(context.Background(), entity)
+
+	is.Equal(len(failures), 0)
+	is.Equal(ctxBroker.MergeEntityCalls()[0].Headers["NGSILD-Tenant"], []string{"sundsvall"})
+}
+
+func TestUnchangedEntitiesAreNotPublishedAgain(t *testing.T) {
+	is := is.New(t)
+
+	merged := 0
+	ctxBroker := &test.ContextBrokerClientMock{
+		MergeEntityFunc: func(ctx context.Context, entityID string, fragment types.EntityFragment, headers map[string][]string) (*ngsild.MergeEntityResult, error) {
+			merged++
+			if entityID == "urn:ngsi-ld:WeatherObserved:3" {
+				return nil, errors.New("merge failed")
+			}
+			return nil, nil
+		},
+	}
+
+	cache := dedup.NewCache()
+	p := WithDeduplication(NewPublisher(ctxBroker), cache, "weather")
+
+	failures := p.Publish(context.Background(), testEntities("1", "2", "3")...)
+	is.Equal(len(failures), 1)
+	is.Equal(merged, 3)
+
+	changed := testEntities("2")[0]
+	changed.Attributes = append(changed.Attributes, decorators.Number("temperature", 2.8))
+
+	failures = p.Publish(context.Background(), testEntities("1")[0], changed, testEntities("3")[0])
+	is.Equal(len(failures), 1)
+	is.Equal(merged, 5) // only the changed entity, and the one that failed, should be published again
+
+	cache.Forget("weather")
+
+	p.Publish(context.Background(), testEntities("1")...)
+	is.Equal(merged, 6) // everything should be published again once the scope has been forgotten
+}
@@ -0,0 +1,129 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strconv"
+
+	"github.com/diwise/context-broker/pkg/ngsild/types/entities"
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+)
+
+// TenantRoute routes the entities that are located in any of Counties, or within Area, to Tenant
+type TenantRoute struct {
+	Tenant   string
+	Counties []string
+	// Area is a polygon in WGS84
+	Area geometry.Polygon
+}
+
+// Routing describes the tenants that the entities of a feed are published to
+type Routing struct {
+	// Tenant receives the entities that do not match any of the routes, or the default tenant if empty
+	Tenant string
+	// Routes are tried in order, and the first that matches an entity decides its tenant
+	Routes []TenantRoute
+}
+
+// WithTenants creates a Publisher that sets the tenant of every entity according to routing before it
+// is published by next
+func WithTenants(next Publisher, routing Routing) Publisher {
+	if routing.Tenant == "" && len(routing.Routes) == 0 {
+		return next
+	}
+
+	return &tenantPublisher{next: next, routing: routing}
+}
+
+type tenantPublisher struct {
+	next    Publisher
+	routing Routing
+}
+
+func (p *tenantPublisher) Publish(ctx context.Context, batch ...Entity) map[string]error {
+	routed := make([]Entity, 0, len(batch))
+
+	for _, e := range batch {
+		e.Tenant = p.routing.tenantOf(e)
+		routed = append(routed, e)
+	}
+
+	return p.next.Publish(ctx, routed...)
+}
+
+func (r Routing) tenantOf(e Entity) string {
+	var location *geometry.Point
+
+	for _, route := range r.Routes {
+		for _, county := range route.Counties {
+			if slices.Contains(e.Counties, county) {
+				return route.Tenant
+			}
+		}
+
+		if len(route.Area) > 0 {
+			if location == nil {
+				location = locationOf(e)
+			}
+
+			if location != nil && route.Area.Contains(*location) {
+				return route.Tenant
+			}
+		}
+	}
+
+	return r.Tenant
+}
+
+// locationOf returns the first position of the location of an entity, or nil if it has none
+func locationOf(e Entity) *geometry.Point {
+	entity, err := entities.New(e.ID, e.Type, e.Attributes...)
+	if err != nil {
+		return nil
+	}
+
+	b, err := entity.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+
+	contents := struct {
+		Location struct {
+			Value struct {
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"value"`
+		} `json:"location"`
+	}{}
+
+	if json.Unmarshal(b, &contents) != nil {
+		return nil
+	}
+
+	return firstPosition(contents.Location.Value.Coordinates)
+}
+
+// firstPosition finds the first [longitude, latitude] position in the coordinates of any GeoJSON geometry
+func firstPosition(coordinates json.RawMessage) *geometry.Point {
+	position := []float64{}
+	if json.Unmarshal(coordinates, &position) == nil && len(position) >= 2 {
+		return &geometry.Point{X: position[0], Y: position[1]}
+	}
+
+	nested := []json.RawMessage{}
+	if json.Unmarshal(coordinates, &nested) == nil && len(nested) > 0 {
+		return firstPosition(nested[0])
+	}
+
+	return nil
+}
+
+// CountyNumbers returns the county numbers of a Trafikverket object as the county codes that entities are
+// routed by
+func CountyNumbers(numbers ...int) []string {
+	counties := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		counties = append(counties, strconv.Itoa(n))
+	}
+	return counties
+}
@@ -0,0 +1,121 @@
+package sweref99
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+)
+
+// ParseArea parses an area that is either a box, given by the latitude and longitude of its south west
+// and north east corners such as "62.2 17.1, 62.5 17.5", or a WKT POLYGON such as a municipality boundary.
+// The coordinates of a polygon are given in crs, that is either "WGS84" or the name of a SWEREF 99
+// projection accepted by ByName. The area is always returned in WGS84.
+func ParseArea(area, crs string) (geometry.Polygon, error) {
+	area = strings.TrimSpace(area)
+
+	if !strings.HasPrefix(strings.ToUpper(area), "POLYGON") {
+		return parseBox(area)
+	}
+
+	g, err := geometry.Parse(area)
+	if err != nil {
+		return nil, err
+	}
+
+	polygon, ok := g.(geometry.Polygon)
+	if !ok {
+		return nil, fmt.Errorf("expected a polygon but got a %s", g.Type())
+	}
+
+	if crs == "" || strings.EqualFold(crs, "WGS84") || strings.EqualFold(crs, "EPSG:4326") {
+		return polygon, nil
+	}
+
+	projection, err := ByName(crs)
+	if err != nil {
+		return nil, err
+	}
+
+	return projection.ToWGS84Polygon(polygon), nil
+}
+
+// ParseBox parses a box given by the easting and northing in SWEREF 99 TM of its south west and north east
+// corners, such as "527000 6879000, 652500 6950000", as used by the Trafikverket API. The box must be within
+// Sweden, where SWEREF 99 TM is used. The box is returned in WGS84.
+func ParseBox(box string) (geometry.Polygon, error) {
+	corners, err := parseCorners(box, "easting", "northing")
+	if err != nil {
+		return nil, err
+	}
+
+	sw, ne := TM.ToWGS84(corners[0]), TM.ToWGS84(corners[1])
+	for _, corner := range []geometry.Point{sw, ne} {
+		if corner.Y < 54.96 || corner.Y > 69.07 || corner.X < 10.03 || corner.X > 24.17 {
+			return nil, fmt.Errorf("the box %q is not within the area of SWEREF 99 TM", box)
+		}
+	}
+
+	return geometry.Polygon{{sw, {X: ne.X, Y: sw.Y}, ne, {X: sw.X, Y: ne.Y}, sw}}, nil
+}
+
+func parseBox(box string) (geometry.Polygon, error) {
+	corners, err := parseCorners(box, "latitude", "longitude")
+	if err != nil {
+		return nil, err
+	}
+
+	points := []geometry.Point{}
+
+	for _, corner := range corners {
+		lat, lon := corner.X, corner.Y
+		if lat < -90 || lat > 90 {
+			return nil, fmt.Errorf("latitude %v is out of range", lat)
+		}
+		if lon < -180 || lon > 180 {
+			return nil, fmt.Errorf("longitude %v is out of range", lon)
+		}
+
+		points = append(points, geometry.Point{X: lon, Y: lat})
+	}
+
+	sw, ne := points[0], points[1]
+	return geometry.Polygon{{sw, {X: ne.X, Y: sw.Y}, ne, {X: sw.X, Y: ne.Y}, sw}}, nil
+}
+
+// parseCorners parses the two corners of a box, each given as two numbers named first and second, and
+// returns them with first as X and second as Y. The first corner must be less than the second in both.
+func parseCorners(box, first, second string) ([]geometry.Point, error) {
+	corners := strings.Split(box, ",")
+	if len(corners) != 2 {
+		return nil, fmt.Errorf("a box must have exactly two corners, got %q", box)
+	}
+
+	points := []geometry.Point{}
+
+	for _, corner := range corners {
+		values := strings.Fields(corner)
+		if len(values) != 2 {
+			return nil, fmt.Errorf("a corner must be given as \"%s %s\", got %q", first, second, corner)
+		}
+
+		x, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", first, values[0])
+		}
+
+		y, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", second, values[1])
+		}
+
+		points = append(points, geometry.Point{X: x, Y: y})
+	}
+
+	if points[0].X >= points[1].X || points[0].Y >= points[1].Y {
+		return nil, fmt.Errorf("the first corner of a box must be south west of the second")
+	}
+
+	return points, nil
+}
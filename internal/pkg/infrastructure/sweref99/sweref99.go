@@ -0,0 +1,153 @@
+// Package sweref99 transforms coordinates between WGS84 and the SWEREF 99 projections, SWEREF 99 TM and
+// the regional SWEREF 99 zones, using the Gauss-Krüger formulas published by Lantmäteriet.
+package sweref99
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+)
+
+var ErrUnknownProjection = errors.New("unknown projection")
+
+// Projection is a transverse Mercator projection on the GRS 80 ellipsoid. Projected points use X for
+// easting and Y for northing, and WGS84 points use X for longitude and Y for latitude.
+type Projection struct {
+	Name string
+	EPSG int
+
+	centralMeridian float64
+	scale           float64
+	falseNorthing   float64
+	falseEasting    float64
+}
+
+var (
+	TM = Projection{"SWEREF 99 TM", 3006, 15.00, 0.9996, 0, 500000}
+
+	Zones = []Projection{
+		{"SWEREF 99 12 00", 3007, 12.00, 1, 0, 150000},
+		{"SWEREF 99 13 30", 3008, 13.50, 1, 0, 150000},
+		{"SWEREF 99 15 00", 3009, 15.00, 1, 0, 150000},
+		{"SWEREF 99 16 30", 3010, 16.50, 1, 0, 150000},
+		{"SWEREF 99 18 00", 3011, 18.00, 1, 0, 150000},
+		{"SWEREF 99 14 15", 3012, 14.25, 1, 0, 150000},
+		{"SWEREF 99 15 45", 3013, 15.75, 1, 0, 150000},
+		{"SWEREF 99 17 15", 3014, 17.25, 1, 0, 150000},
+		{"SWEREF 99 18 45", 3015, 18.75, 1, 0, 150000},
+		{"SWEREF 99 20 15", 3016, 20.25, 1, 0, 150000},
+		{"SWEREF 99 21 45", 3017, 21.75, 1, 0, 150000},
+		{"SWEREF 99 23 15", 3018, 23.25, 1, 0, 150000},
+	}
+)
+
+// ByName returns the projection with the given name, such as "SWEREF 99 TM", "SWEREF99 1630" or "EPSG:3010"
+func ByName(name string) (Projection, error) {
+	normalize := func(s string) string {
+		return strings.ToUpper(strings.NewReplacer(" ", "", "_", "").Replace(s))
+	}
+
+	for _, p := range append([]Projection{TM}, Zones...) {
+		if normalize(name) == normalize(p.Name) || normalize(name) == fmt.Sprintf("EPSG:%d", p.EPSG) {
+			return p, nil
+		}
+	}
+
+	return Projection{}, fmt.Errorf("%w %q", ErrUnknownProjection, name)
+}
+
+// GRS 80
+const (
+	semiMajorAxis = 6378137.0
+	flattening    = 1.0 / 298.257222101
+)
+
+var (
+	e2     = flattening * (2 - flattening)
+	n      = flattening / (2 - flattening)
+	aRoof  = semiMajorAxis / (1 + n) * (1 + n*n/4 + n*n*n*n/64)
+	beta   = [4]float64{n/2 - 2*n*n/3 + 5*n*n*n/16 + 41*n*n*n*n/180, 13*n*n/48 - 3*n*n*n/5 + 557*n*n*n*n/1440, 61*n*n*n/240 - 103*n*n*n*n/140, 49561 * n * n * n * n / 161280}
+	delta  = [4]float64{n/2 - 2*n*n/3 + 37*n*n*n/96 - n*n*n*n/360, n*n/48 + n*n*n/15 - 437*n*n*n*n/1440, 17*n*n*n/480 - 37*n*n*n*n/840, 4397 * n * n * n * n / 161280}
+	latFwd = [4]float64{e2, (5*e2*e2 - e2*e2*e2) / 6, (104*e2*e2*e2 - 45*e2*e2*e2*e2) / 120, 1237 * e2 * e2 * e2 * e2 / 1260}
+	latInv = [4]float64{e2 + e2*e2 + e2*e2*e2 + e2*e2*e2*e2, -(7*e2*e2 + 17*e2*e2*e2 + 30*e2*e2*e2*e2) / 6, (224*e2*e2*e2 + 889*e2*e2*e2*e2) / 120, -(4279 * e2 * e2 * e2 * e2) / 1260}
+)
+
+func radians(degrees float64) float64 { return degrees * math.Pi / 180 }
+func degrees(radians float64) float64 { return radians * 180 / math.Pi }
+
+// FromWGS84 projects a WGS84 longitude and latitude onto this projection
+func (p Projection) FromWGS84(pt geometry.Point) geometry.Point {
+	lat, lon := radians(pt.Y), radians(pt.X)
+	sin2 := math.Pow(math.Sin(lat), 2)
+
+	conformalLat := lat - math.Sin(lat)*math.Cos(lat)*(latFwd[0]+latFwd[1]*sin2+latFwd[2]*sin2*sin2+latFwd[3]*sin2*sin2*sin2)
+	deltaLon := lon - radians(p.centralMeridian)
+
+	xi := math.Atan(math.Tan(conformalLat) / math.Cos(deltaLon))
+	eta := math.Atanh(math.Cos(conformalLat) * math.Sin(deltaLon))
+
+	northing, easting := xi, eta
+	for i, b := range beta {
+		k := float64(2 * (i + 1))
+		northing += b * math.Sin(k*xi) * math.Cosh(k*eta)
+		easting += b * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+
+	return geometry.Point{
+		X: p.scale*aRoof*easting + p.falseEasting,
+		Y: p.scale*aRoof*northing + p.falseNorthing,
+		Z: pt.Z,
+	}
+}
+
+// ToWGS84 returns the WGS84 longitude and latitude of a point given in this projection
+func (p Projection) ToWGS84(pt geometry.Point) geometry.Point {
+	xi := (pt.Y - p.falseNorthing) / (p.scale * aRoof)
+	eta := (pt.X - p.falseEasting) / (p.scale * aRoof)
+
+	xiPrim, etaPrim := xi, eta
+	for i, d := range delta {
+		k := float64(2 * (i + 1))
+		xiPrim -= d * math.Sin(k*xi) * math.Cosh(k*eta)
+		etaPrim -= d * math.Cos(k*xi) * math.Sinh(k*eta)
+	}
+
+	conformalLat := math.Asin(math.Sin(xiPrim) / math.Cosh(etaPrim))
+	deltaLon := math.Atan(math.Sinh(etaPrim) / math.Cos(xiPrim))
+
+	sin2 := math.Pow(math.Sin(conformalLat), 2)
+	lat := conformalLat + math.Sin(conformalLat)*math.Cos(conformalLat)*(latInv[0]+latInv[1]*sin2+latInv[2]*sin2*sin2+latInv[3]*sin2*sin2*sin2)
+
+	return geometry.Point{
+		X: p.centralMeridian + degrees(deltaLon),
+		Y: degrees(lat),
+		Z: pt.Z,
+	}
+}
+
+// FromWGS84Polygon projects every point of a WGS84 polygon onto this projection
+func (p Projection) FromWGS84Polygon(polygon geometry.Polygon) geometry.Polygon {
+	return transformPolygon(polygon, p.FromWGS84)
+}
+
+// ToWGS84Polygon returns the WGS84 equivalent of a polygon given in this projection
+func (p Projection) ToWGS84Polygon(polygon geometry.Polygon) geometry.Polygon {
+	return transformPolygon(polygon, p.ToWGS84)
+}
+
+func transformPolygon(polygon geometry.Polygon, transform func(geometry.Point) geometry.Point) geometry.Polygon {
+	result := make(geometry.Polygon, 0, len(polygon))
+
+	for _, ring := range polygon {
+		transformed := make(geometry.LineString, 0, len(ring))
+		for _, pt := range ring {
+			transformed = append(transformed, transform(pt))
+		}
+		result = append(result, transformed)
+	}
+
+	return result
+}
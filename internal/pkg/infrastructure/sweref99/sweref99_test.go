@@ -0,0 +1,75 @@
+package sweref99
+
+import (
+	"math"
+	"testing"
+
+	"github.com/diwise/ingress-trafikverket/internal/pkg/infrastructure/geometry"
+	"github.com/matryer/is"
+)
+
+// knownPoints have been verified against an independent implementation of the transverse Mercator
+// projection. The point on the central meridian at 60°N is the meridian arc length of GRS 80 scaled by 0.9996.
+var knownPoints = []struct {
+	projection Projection
+	wgs84      geometry.Point
+	projected  geometry.Point
+}{
+	{TM, geometry.Point{X: 15, Y: 0}, geometry.Point{X: 500000, Y: 0}},
+	{TM, geometry.Point{X: 15, Y: 60}, geometry.Point{X: 500000, Y: 6651411.190}},
+	{TM, geometry.Point{X: 18, Y: 59.33}, geometry.Point{X: 670667.450, Y: 6580643.052}},
+	{TM, geometry.Point{X: 17.3058, Y: 62.3908}, geometry.Point{X: 619203.401, Y: 6919842.775}},
+	{TM, geometry.Point{X: 13, Y: 55.6}, geometry.Point{X: 373988.372, Y: 6163377.116}},
+	{TM, geometry.Point{X: 20.22, Y: 67.85}, geometry.Point{X: 719415.398, Y: 7535406.437}},
+	{Zones[3], geometry.Point{X: 17.3058, Y: 62.3908}, geometry.Point{X: 191679.905, Y: 6920744.812}},
+}
+
+func TestFromWGS84(t *testing.T) {
+	is := is.New(t)
+
+	for _, kp := range knownPoints {
+		p := kp.projection.FromWGS84(kp.wgs84)
+		is.True(math.Abs(p.X-kp.projected.X) < 0.01) // easting should be within a centimetre
+		is.True(math.Abs(p.Y-kp.projected.Y) < 0.01) // northing should be within a centimetre
+	}
+}
+
+func TestToWGS84(t *testing.T) {
+	is := is.New(t)
+
+	for _, kp := range knownPoints {
+		p := kp.projection.ToWGS84(kp.projected)
+		is.True(math.Abs(p.X-kp.wgs84.X) < 1e-7) // longitude should be within a centimetre
+		is.True(math.Abs(p.Y-kp.wgs84.Y) < 1e-7) // latitude should be within a centimetre
+	}
+}
+
+func TestByName(t *testing.T) {
+	is := is.New(t)
+
+	for _, name := range []string{"SWEREF 99 16 30", "SWEREF99 1630", "sweref99_1630", "EPSG:3010"} {
+		p, err := ByName(name)
+		is.NoErr(err)
+		is.Equal(p.EPSG, 3010)
+	}
+
+	_, err := ByName("RT90 2.5 gon V")
+	is.True(err != nil) // expected an error for an unsupported projection
+}
+
+func TestParseArea(t *testing.T) {
+	is := is.New(t)
+
+	box, err := ParseArea("62.2 17.1, 62.5 17.5", "")
+	is.NoErr(err)
+	is.Equal(box[0][0], geometry.Point{X: 17.1, Y: 62.2})
+	is.Equal(box[0][2], geometry.Point{X: 17.5, Y: 62.5})
+
+	_, err = ParseArea("62.5 17.5, 62.2 17.1", "")
+	is.True(err != nil) // expected an error for corners in the wrong order
+
+	polygon, err := ParseArea("POLYGON ((619203.401 6919842.775, 670667.450 6580643.052, 500000 6651411.190, 619203.401 6919842.775))", "SWEREF 99 TM")
+	is.NoErr(err)
+	is.True(math.Abs(polygon[0][1].X-18) < 1e-7)
+	is.True(math.Abs(polygon[0][1].Y-59.33) < 1e-7)
+}
@@ -0,0 +1,131 @@
+package trafikverket
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/diwise/service-chassis/pkg/infrastructure/o11y/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+)
+
+type Client interface {
+	Query(ctx context.Context, queries ...Query) ([]byte, error)
+	Stream(ctx context.Context, sseURL string, onEvent func(ctx context.Context, data []byte)) error
+}
+
+var tracer = otel.Tracer("trafikverket-client")
+
+func NewClient(authKey, apiURL string, options ...func(*tfvClient)) Client {
+	c := &tfvClient{
+		authKey: authKey,
+		apiURL:  apiURL,
+		retries: retryTransport{
+			attempts:       4,
+			initialBackoff: 500 * time.Millisecond,
+			maxBackoff:     10 * time.Second,
+			timeout:        10 * time.Second,
+		},
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	transport := otelhttp.NewTransport(http.DefaultTransport)
+	c.retries.next = transport
+
+	c.httpClient = http.Client{Transport: &c.retries}
+	c.streamClient = http.Client{Transport: transport}
+
+	return c
+}
+
+// Timeout overrides the default timeout of ten seconds for each attempt of a request to the Trafikverket API
+func Timeout(timeout time.Duration) func(*tfvClient) {
+	return func(c *tfvClient) {
+		c.retries.timeout = timeout
+	}
+}
+
+type tfvClient struct {
+	authKey string
+	apiURL  string
+	retries retryTransport
+
+	httpClient   http.Client
+	streamClient http.Client
+}
+
+type login struct {
+	AuthenticationKey string `xml:"authenticationkey,attr"`
+}
+
+type request struct {
+	XMLName xml.Name `xml:"REQUEST"`
+	Login   login    `xml:"LOGIN"`
+	Queries []Query  `xml:"QUERY"`
+}
+
+// Query sends one or more queries to the Trafikverket API in a single request and returns the raw response body
+func (c *tfvClient) Query(ctx context.Context, queries ...Query) ([]byte, error) {
+	var err error
+	ctx, span := tracer.Start(ctx, "query")
+	defer func() { tracing.RecordAnyErrorAndEndSpan(err, span) }()
+
+	requestBody, err := NewRequestBody(c.authKey, queries...)
+	if err != nil {
+		err = &requestError{msg: fmt.Sprintf("failed to create request body: %s", err.Error())}
+		return nil, err
+	}
+
+	apiReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, bytes.NewReader(requestBody))
+	if err != nil {
+		err = &requestError{msg: fmt.Sprintf("failed to create request: %s", err.Error())}
+		return nil, err
+	}
+	apiReq.Header.Set("Content-Type", "text/xml")
+
+	start := time.Now()
+
+	apiResponse, err := c.httpClient.Do(apiReq)
+	if err != nil {
+		recordRequest(ctx, queries, start, 0)
+		err = &requestError{msg: fmt.Sprintf("request to trafikverket failed: %s", err.Error()), unavailable: ctx.Err() == nil}
+		return nil, err
+	}
+	defer apiResponse.Body.Close()
+
+	recordRequest(ctx, queries, start, apiResponse.StatusCode)
+
+	if apiResponse.StatusCode != http.StatusOK {
+		err = &requestError{
+			msg:         fmt.Sprintf("expected status code %d from trafikverket, but got %d", http.StatusOK, apiResponse.StatusCode),
+			unavailable: apiResponse.StatusCode == http.StatusTooManyRequests || apiResponse.StatusCode >= http.StatusInternalServerError,
+			retryAfter:  parseRetryAfter(apiResponse.Header.Get("Retry-After")),
+		}
+		return nil, err
+	}
+
+	return io.ReadAll(apiResponse.Body)
+}
+
+// NewRequestBody marshals the supplied queries into a complete XML <REQUEST> with the authentication key
+// in a <LOGIN> element. All attribute values and element contents are escaped by the encoder.
+func NewRequestBody(authKey string, queries ...Query) ([]byte, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("at least one query is required")
+	}
+
+	req := request{
+		Login:   login{AuthenticationKey: authKey},
+		Queries: queries,
+	}
+
+	return xml.Marshal(req)
+}
@@ -0,0 +1,126 @@
+package trafikverket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/diwise/service-chassis/pkg/test/http"
+	"github.com/diwise/service-chassis/pkg/test/http/expects"
+	"github.com/diwise/service-chassis/pkg/test/http/response"
+	"github.com/matryer/is"
+)
+
+func TestThatQueryIsMarshalledCorrectly(t *testing.T) {
+	is := is.New(t)
+
+	query := NewQuery(
+		"Situation", "1.6",
+		Namespace("road.trafficinfo"),
+		ChangeID("0"),
+		IncludeDeletedObjects(),
+		Limit(10),
+		OrderBy("Deviation.StartTime desc"),
+		Where(Eq("Deviation.MessageType", "Olycka")),
+		Include("Deviation.Id", "Deleted"),
+		Exclude("Deviation.Message"),
+	)
+
+	body, err := NewRequestBody("key", query)
+	is.NoErr(err)
+
+	const expectation string = `<REQUEST><LOGIN authenticationkey="key"></LOGIN>` +
+		`<QUERY objecttype="Situation" namespace="road.trafficinfo" schemaversion="1.6" changeid="0" includedeletedobjects="true" limit="10" orderby="Deviation.StartTime desc">` +
+		`<FILTER><EQ name="Deviation.MessageType" value="Olycka"></EQ></FILTER>` +
+		`<INCLUDE>Deviation.Id</INCLUDE><INCLUDE>Deleted</INCLUDE>` +
+		`<EXCLUDE>Deviation.Message</EXCLUDE>` +
+		`</QUERY></REQUEST>`
+
+	is.Equal(string(body), expectation)
+}
+
+func TestThatValuesAreEscaped(t *testing.T) {
+	is := is.New(t)
+
+	query := NewQuery("Situation", "1.6", Where(Eq("Deviation.CountyNo", `1" /><EQ name="x`)))
+
+	body, err := NewRequestBody(`a"><b>`, query)
+	is.NoErr(err)
+
+	is.Equal(string(body), `<REQUEST><LOGIN authenticationkey="a&#34;&gt;&lt;b&gt;"></LOGIN>`+
+		`<QUERY objecttype="Situation" schemaversion="1.6">`+
+		`<FILTER><EQ name="Deviation.CountyNo" value="1&#34; /&gt;&lt;EQ name=&#34;x"></EQ></FILTER>`+
+		`</QUERY></REQUEST>`)
+}
+
+func TestQueryPostsRequestToAPI(t *testing.T) {
+	is := is.New(t)
+	ms := NewMockServiceThat(
+		Expects(is,
+			expects.RequestMethod(http.MethodPost),
+			expects.RequestHeaderContains("Content-Type", "text/xml"),
+			expects.RequestBodyContaining(`objecttype="WeatherMeasurepoint"`, `authenticationkey="key"`),
+		),
+		Returns(response.Code(http.StatusOK), response.Body([]byte(`{"RESPONSE":{}}`))),
+	)
+	defer ms.Close()
+
+	c := NewClient("key", ms.URL())
+	body, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+
+	is.NoErr(err)
+	is.Equal(string(body), `{"RESPONSE":{}}`)
+}
+
+func TestQueryFailsOnUnexpectedStatusCode(t *testing.T) {
+	is := is.New(t)
+	ms := NewMockServiceThat(
+		Expects(is, expects.AnyInput()),
+		Returns(response.Code(http.StatusUnauthorized)),
+	)
+	defer ms.Close()
+
+	c := NewClient("key", ms.URL())
+	_, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+
+	is.True(err != nil) // expected an error but got none
+}
+
+func TestStreamDispatchesEvents(t *testing.T) {
+	is := is.New(t)
+
+	const stream string = ": keep-alive\n\nid: 1\ndata: {\"RESPONSE\":\ndata: {}}\n\nevent: message\nid: 2\ndata: second\r\n\r\n"
+
+	ms := NewMockServiceThat(
+		Expects(is, expects.RequestMethod(http.MethodGet), expects.RequestHeaderContains("Accept", "text/event-stream")),
+		Returns(response.Code(http.StatusOK), response.ContentType("text/event-stream"), response.Body([]byte(stream))),
+	)
+	defer ms.Close()
+
+	events := []string{}
+
+	c := NewClient("key", ms.URL())
+	err := c.Stream(context.Background(), ms.URL(), func(ctx context.Context, data []byte) {
+		events = append(events, string(data))
+	})
+
+	is.True(errors.Is(err, ErrStreamClosed))
+	is.Equal(events, []string{"{\"RESPONSE\":\n{}}", "second"})
+}
+
+func TestStreamStopsDispatchingWhenContextIsDone(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := []string{}
+
+	err := readEvents(ctx, strings.NewReader("data: first\n\ndata: second\n\n"), func(data []byte) {
+		events = append(events, string(data))
+		cancel()
+	})
+
+	is.True(errors.Is(err, context.Canceled))
+	is.Equal(events, []string{"first"}) // events that were read after the context was done should not be dispatched
+}
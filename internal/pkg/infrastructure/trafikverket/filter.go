@@ -0,0 +1,167 @@
+package trafikverket
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+)
+
+// Filter is an operator element inside the <FILTER> of a query. Comparison operators
+// are leaf elements, while And, Or and ElementMatch group other filters.
+type Filter struct {
+	operator string
+	attrs    []xml.Attr
+	children []Filter
+}
+
+func newFilter(operator string, attrs ...string) Filter {
+	f := Filter{operator: operator}
+
+	for i := 0; i+1 < len(attrs); i += 2 {
+		f.attrs = append(f.attrs, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+	}
+
+	return f
+}
+
+func newGroup(operator string, filters []Filter) Filter {
+	return Filter{operator: operator, children: filters}
+}
+
+// Eq matches objects where the field equals the given value
+func Eq(name, value string) Filter {
+	return newFilter("EQ", "name", name, "value", value)
+}
+
+// Ne matches objects where the field does not equal the given value
+func Ne(name, value string) Filter {
+	return newFilter("NE", "name", name, "value", value)
+}
+
+// Gt matches objects where the field is greater than the given value
+func Gt(name, value string) Filter {
+	return newFilter("GT", "name", name, "value", value)
+}
+
+// Gte matches objects where the field is greater than or equal to the given value
+func Gte(name, value string) Filter {
+	return newFilter("GTE", "name", name, "value", value)
+}
+
+// Lt matches objects where the field is less than the given value
+func Lt(name, value string) Filter {
+	return newFilter("LT", "name", name, "value", value)
+}
+
+// Lte matches objects where the field is less than or equal to the given value
+func Lte(name, value string) Filter {
+	return newFilter("LTE", "name", name, "value", value)
+}
+
+// Exists matches objects where the field is present (or absent if exists is false)
+func Exists(name string, exists bool) Filter {
+	return newFilter("EXISTS", "name", name, "value", strconv.FormatBool(exists))
+}
+
+// In matches objects where the field equals any of the given values
+func In(name string, values ...string) Filter {
+	return newFilter("IN", "name", name, "value", strings.Join(values, ","))
+}
+
+// NotIn matches objects where the field equals none of the given values
+func NotIn(name string, values ...string) Filter {
+	return newFilter("NOTIN", "name", name, "value", strings.Join(values, ","))
+}
+
+// Like matches objects where the field matches the given regular expression, e.g. "/^E4/"
+func Like(name, pattern string) Filter {
+	return newFilter("LIKE", "name", name, "value", pattern)
+}
+
+// NotLike matches objects where the field does not match the given regular expression
+func NotLike(name, pattern string) Filter {
+	return newFilter("NOTLIKE", "name", name, "value", pattern)
+}
+
+// Within matches objects whose geometry field lies within the given shape, e.g.
+//
+//	Within("Geometry.SWEREF99TM", "box", "527000 6879000, 652500 6950000")
+func Within(name, shape, value string) Filter {
+	return newFilter("WITHIN", "name", name, "shape", shape, "value", value)
+}
+
+// Point is a coordinate pair in the coordinate system of the geometry field that is filtered on,
+// i.e. easting and northing for SWEREF99TM or longitude and latitude for WGS84.
+type Point struct {
+	X float64
+	Y float64
+}
+
+func (p Point) String() string {
+	return strconv.FormatFloat(p.X, 'f', -1, 64) + " " + strconv.FormatFloat(p.Y, 'f', -1, 64)
+}
+
+func joinPoints(points []Point) string {
+	s := make([]string, 0, len(points))
+	for _, p := range points {
+		s = append(s, p.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+// WithinBox matches objects inside the rectangle given by its lower left and upper right corners
+func WithinBox(name string, lowerLeft, upperRight Point) Filter {
+	return Within(name, "box", joinPoints([]Point{lowerLeft, upperRight}))
+}
+
+// WithinCenter matches objects within radius meters from the center point
+func WithinCenter(name string, center Point, radius float64) Filter {
+	return withinCenter(name, center.String(), radius)
+}
+
+func withinCenter(name, center string, radius float64) Filter {
+	return newFilter("WITHIN", "name", name, "shape", "center", "value", center, "radius", strconv.FormatFloat(radius, 'f', -1, 64))
+}
+
+// WithinPolygon matches objects inside the polygon given by its points. The polygon is
+// closed automatically if the last point differs from the first.
+func WithinPolygon(name string, points ...Point) Filter {
+	if len(points) > 0 && points[0] != points[len(points)-1] {
+		points = append(points, points[0])
+	}
+	return Within(name, "polygon", joinPoints(points))
+}
+
+// And matches objects that match all of the given filters
+func And(filters ...Filter) Filter {
+	return newGroup("AND", filters)
+}
+
+// Or matches objects that match at least one of the given filters
+func Or(filters ...Filter) Filter {
+	return newGroup("OR", filters)
+}
+
+// ElementMatch requires that all of the given filters match the same element in an array,
+// e.g. the same Deviation within a Situation
+func ElementMatch(filters ...Filter) Filter {
+	return newGroup("ELEMENTMATCH", filters)
+}
+
+func (f Filter) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	start := xml.StartElement{Name: xml.Name{Local: f.operator}, Attr: f.attrs}
+
+	err := e.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range f.children {
+		err = child.MarshalXML(e, start)
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
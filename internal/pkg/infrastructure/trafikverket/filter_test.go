@@ -0,0 +1,89 @@
+package trafikverket
+
+import (
+	"encoding/xml"
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestThatFiltersAreMarshalledCorrectly(t *testing.T) {
+	is := is.New(t)
+
+	filter := And(
+		Or(
+			Eq("Deviation.MessageType", "Olycka"),
+			Eq("Deviation.MessageType", "Vägarbete"),
+		),
+		In("Deviation.CountyNo", "22", "23"),
+		Exists("Deviation.Geometry", true),
+		ElementMatch(Gte("Deviation.SeverityCode", "4"), NotLike("Deviation.RoadNumber", "/^E4/")),
+		WithinPolygon("Deviation.Geometry.WGS84", Point{17.1, 62.2}, Point{17.5, 62.2}, Point{17.5, 62.5}),
+		WithinCenter("Geometry.SWEREF99TM", Point{6398983, 320011}, 10000),
+	)
+
+	b, err := xml.Marshal(filter)
+	is.NoErr(err)
+
+	is.Equal(string(b), `<AND>`+
+		`<OR><EQ name="Deviation.MessageType" value="Olycka"></EQ><EQ name="Deviation.MessageType" value="Vägarbete"></EQ></OR>`+
+		`<IN name="Deviation.CountyNo" value="22,23"></IN>`+
+		`<EXISTS name="Deviation.Geometry" value="true"></EXISTS>`+
+		`<ELEMENTMATCH><GTE name="Deviation.SeverityCode" value="4"></GTE><NOTLIKE name="Deviation.RoadNumber" value="/^E4/"></NOTLIKE></ELEMENTMATCH>`+
+		`<WITHIN name="Deviation.Geometry.WGS84" shape="polygon" value="17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.2"></WITHIN>`+
+		`<WITHIN name="Geometry.SWEREF99TM" shape="center" value="6398983 320011" radius="10000"></WITHIN>`+
+		`</AND>`)
+}
+
+func TestParseFilter(t *testing.T) {
+	is := is.New(t)
+
+	filter, err := ParseFilter(`and(
+		OR(EQ(Deviation.MessageType, Olycka), EQ(Deviation.MessageType, Vägarbete)),
+		IN(Deviation.CountyNo, 22, 23),
+		WITHIN(Deviation.Geometry.WGS84, polygon, "17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.2"),
+		WITHIN(Geometry.SWEREF99TM, center, "6398983 320011", 500),
+		EXISTS(Deviation.Geometry, false),
+		LIKE(Deviation.Message, "/\"quoted\"/")
+	)`)
+	is.NoErr(err)
+
+	expectation := And(
+		Or(Eq("Deviation.MessageType", "Olycka"), Eq("Deviation.MessageType", "Vägarbete")),
+		In("Deviation.CountyNo", "22", "23"),
+		Within("Deviation.Geometry.WGS84", "polygon", "17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.2"),
+		WithinCenter("Geometry.SWEREF99TM", Point{6398983, 320011}, 500),
+		Exists("Deviation.Geometry", false),
+		Like("Deviation.Message", `/"quoted"/`),
+	)
+
+	actual, _ := xml.Marshal(filter)
+	expected, _ := xml.Marshal(expectation)
+
+	is.Equal(string(actual), string(expected))
+}
+
+func TestParseFilterFailsOnInvalidExpressions(t *testing.T) {
+	is := is.New(t)
+
+	invalid := []string{
+		"",
+		"EQ(Deviation.Id)",
+		"EQ(Deviation.Id, 1",
+		"EQ(Deviation.Id, 1) EQ(Deviation.Id, 2)",
+		"OR(Deviation.Id)",
+		"AND()",
+		"FOO(Deviation.Id, 1)",
+		"EQ(Deviation.Id, EQ(Deviation.Id, 1))",
+		"WITHIN(Geometry.WGS84, circle, \"1 2\")",
+		"WITHIN(Geometry.WGS84, center, \"1 2\")",
+		"EXISTS(Deviation.Id, maybe)",
+		`LIKE(Deviation.Message, "unterminated)`,
+	}
+
+	for _, expression := range invalid {
+		_, err := ParseFilter(expression)
+		is.True(errors.Is(err, ErrInvalidFilter)) // expected expression to be invalid
+	}
+}
@@ -0,0 +1,40 @@
+package trafikverket
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var requestDuration = newRequestDuration()
+
+func newRequestDuration() metric.Float64Histogram {
+	histogram, err := otel.Meter("trafikverket-client").Float64Histogram(
+		"trafikverket.request.duration",
+		metric.WithDescription("Duration of requests to the Trafikverket API, including any retries"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return histogram
+}
+
+// recordRequest records the duration of a request for queries, and the status code of its response or
+// zero if no response was received
+func recordRequest(ctx context.Context, queries []Query, start time.Time, statusCode int) {
+	objectTypes := make([]string, 0, len(queries))
+	for _, q := range queries {
+		objectTypes = append(objectTypes, q.objectType)
+	}
+
+	requestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("objecttype", strings.Join(objectTypes, ",")),
+		attribute.Int("http.response.status_code", statusCode),
+	))
+}
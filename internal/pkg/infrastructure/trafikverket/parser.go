@@ -0,0 +1,283 @@
+package trafikverket
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrInvalidFilter = errors.New("invalid filter expression")
+
+// ParseFilter creates a Filter from a textual expression, making it possible to configure filters
+// without code changes. Operators are written as function calls with the same names as the
+// corresponding XML elements. Arguments containing spaces, commas or parentheses must be quoted.
+//
+//	AND(
+//	  OR(EQ(Deviation.MessageType, Olycka), EQ(Deviation.MessageType, Vägarbete)),
+//	  IN(Deviation.CountyNo, 22, 23),
+//	  WITHIN(Deviation.Geometry.WGS84, polygon, "17.1 62.2, 17.5 62.2, 17.5 62.5, 17.1 62.2")
+//	)
+//
+// WITHIN takes an optional fourth argument with the radius when the shape is center.
+func ParseFilter(expression string) (Filter, error) {
+	p := &parser{input: []rune(expression)}
+
+	f, err := p.parseExpression()
+	if err != nil {
+		return Filter{}, err
+	}
+
+	p.skipWhitespace()
+	if !p.eof() {
+		return Filter{}, p.errorf("unexpected %q after end of expression", string(p.input[p.pos]))
+	}
+
+	return f, nil
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+type argument struct {
+	value  string
+	filter *Filter
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidFilter, fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) skipWhitespace() {
+	for !p.eof() && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *parser) expect(r rune) error {
+	p.skipWhitespace()
+	if p.eof() || p.input[p.pos] != r {
+		return p.errorf("expected %q", string(r))
+	}
+	p.pos++
+	return nil
+}
+
+func isWordRune(r rune) bool {
+	return !unicode.IsSpace(r) && !strings.ContainsRune(`(),"`, r)
+}
+
+func (p *parser) parseWord() string {
+	start := p.pos
+	for !p.eof() && isWordRune(p.input[p.pos]) {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+func (p *parser) parseQuoted() (string, error) {
+	p.pos++ // opening quote
+
+	var sb strings.Builder
+	for !p.eof() {
+		r := p.input[p.pos]
+		p.pos++
+
+		switch r {
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated escape sequence")
+			}
+			sb.WriteRune(p.input[p.pos])
+			p.pos++
+		case '"':
+			return sb.String(), nil
+		default:
+			sb.WriteRune(r)
+		}
+	}
+
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) parseExpression() (Filter, error) {
+	p.skipWhitespace()
+
+	operator := strings.ToUpper(p.parseWord())
+	if operator == "" {
+		return Filter{}, p.errorf("expected an operator")
+	}
+
+	args, err := p.parseArguments()
+	if err != nil {
+		return Filter{}, err
+	}
+
+	return newFilterFromArguments(p, operator, args)
+}
+
+func (p *parser) parseArguments() ([]argument, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+
+	args := []argument{}
+
+	for {
+		p.skipWhitespace()
+		if p.eof() {
+			return nil, p.errorf("unexpected end of expression")
+		}
+
+		if p.input[p.pos] == ')' && len(args) == 0 {
+			p.pos++
+			return args, nil
+		}
+
+		arg, err := p.parseArgument()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		p.skipWhitespace()
+		if p.eof() {
+			return nil, p.errorf("unexpected end of expression")
+		}
+
+		switch p.input[p.pos] {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return args, nil
+		default:
+			return nil, p.errorf("expected ',' or ')'")
+		}
+	}
+}
+
+func (p *parser) parseArgument() (argument, error) {
+	if p.input[p.pos] == '"' {
+		s, err := p.parseQuoted()
+		return argument{value: s}, err
+	}
+
+	start := p.pos
+	word := p.parseWord()
+	if word == "" {
+		return argument{}, p.errorf("expected an argument")
+	}
+
+	p.skipWhitespace()
+	if !p.eof() && p.input[p.pos] == '(' {
+		p.pos = start
+		f, err := p.parseExpression()
+		if err != nil {
+			return argument{}, err
+		}
+		return argument{filter: &f}, nil
+	}
+
+	return argument{value: word}, nil
+}
+
+func newFilterFromArguments(p *parser, operator string, args []argument) (Filter, error) {
+	switch operator {
+	case "AND", "OR", "ELEMENTMATCH":
+		if len(args) == 0 {
+			return Filter{}, p.errorf("%s requires at least one filter", operator)
+		}
+
+		filters := make([]Filter, 0, len(args))
+		for _, arg := range args {
+			if arg.filter == nil {
+				return Filter{}, p.errorf("%s only accepts filters as arguments, got %q", operator, arg.value)
+			}
+			filters = append(filters, *arg.filter)
+		}
+
+		return newGroup(operator, filters), nil
+	}
+
+	values := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg.filter != nil {
+			return Filter{}, p.errorf("%s does not accept nested filters", operator)
+		}
+		values = append(values, arg.value)
+	}
+
+	comparisons := map[string]func(string, string) Filter{
+		"EQ": Eq, "NE": Ne, "GT": Gt, "GTE": Gte, "LT": Lt, "LTE": Lte, "LIKE": Like, "NOTLIKE": NotLike,
+	}
+
+	if cmp, ok := comparisons[operator]; ok {
+		if len(values) != 2 {
+			return Filter{}, p.errorf("%s requires a name and a value", operator)
+		}
+		return cmp(values[0], values[1]), nil
+	}
+
+	switch operator {
+	case "IN", "NOTIN":
+		if len(values) < 2 {
+			return Filter{}, p.errorf("%s requires a name and at least one value", operator)
+		}
+		if operator == "IN" {
+			return In(values[0], values[1:]...), nil
+		}
+		return NotIn(values[0], values[1:]...), nil
+	case "EXISTS":
+		if len(values) < 1 || len(values) > 2 {
+			return Filter{}, p.errorf("EXISTS requires a name and an optional boolean")
+		}
+		exists := true
+		if len(values) == 2 {
+			b, err := strconv.ParseBool(values[1])
+			if err != nil {
+				return Filter{}, p.errorf("EXISTS requires a boolean value, got %q", values[1])
+			}
+			exists = b
+		}
+		return Exists(values[0], exists), nil
+	case "WITHIN":
+		return newWithinFromArguments(p, values)
+	}
+
+	return Filter{}, p.errorf("unknown operator %q", operator)
+}
+
+func newWithinFromArguments(p *parser, values []string) (Filter, error) {
+	if len(values) < 3 || len(values) > 4 {
+		return Filter{}, p.errorf("WITHIN requires a name, a shape, a value and an optional radius")
+	}
+
+	shape := strings.ToLower(values[1])
+
+	switch shape {
+	case "box", "polygon":
+		if len(values) != 3 {
+			return Filter{}, p.errorf("WITHIN with shape %s does not accept a radius", shape)
+		}
+		return Within(values[0], shape, values[2]), nil
+	case "center":
+		if len(values) != 4 {
+			return Filter{}, p.errorf("WITHIN with shape center requires a radius")
+		}
+		radius, err := strconv.ParseFloat(values[3], 64)
+		if err != nil {
+			return Filter{}, p.errorf("invalid radius %q", values[3])
+		}
+		return withinCenter(values[0], values[2], radius), nil
+	}
+
+	return Filter{}, p.errorf("unknown shape %q", values[1])
+}
@@ -0,0 +1,176 @@
+package trafikverket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"strconv"
+)
+
+// Query is a single <QUERY> element in a request to the Trafikverket API
+type Query struct {
+	objectType            string
+	namespace             string
+	schemaVersion         string
+	changeID              string
+	includeDeletedObjects bool
+	limit                 int
+	orderBy               string
+	sseURL                bool
+
+	filters  []Filter
+	includes []string
+	excludes []string
+}
+
+type QueryOption func(*Query)
+
+// NewQuery creates a query for a given object type and schema version, e.g. "WeatherMeasurepoint" and "2.1"
+func NewQuery(objectType, schemaVersion string, options ...QueryOption) Query {
+	q := Query{
+		objectType:    objectType,
+		schemaVersion: schemaVersion,
+	}
+
+	for _, option := range options {
+		option(&q)
+	}
+
+	return q
+}
+
+// Namespace sets the namespace of the object type, e.g. "road.trafficinfo"
+func Namespace(namespace string) QueryOption {
+	return func(q *Query) {
+		q.namespace = namespace
+	}
+}
+
+// ChangeID requests only the objects that have changed since the given change id. Use "0" to
+// get all objects along with a change id that can be used in subsequent queries.
+func ChangeID(changeID string) QueryOption {
+	return func(q *Query) {
+		q.changeID = changeID
+	}
+}
+
+// IncludeDeletedObjects asks the API to return objects that have been deleted since the last change id
+func IncludeDeletedObjects() QueryOption {
+	return func(q *Query) {
+		q.includeDeletedObjects = true
+	}
+}
+
+// Limit sets the maximum number of objects returned by the query
+func Limit(limit int) QueryOption {
+	return func(q *Query) {
+		q.limit = limit
+	}
+}
+
+// OrderBy sorts the result on one or more comma separated fields, e.g. "ModifiedTime desc"
+func OrderBy(orderBy string) QueryOption {
+	return func(q *Query) {
+		q.orderBy = orderBy
+	}
+}
+
+// SSEURL asks the API to include an URL to a stream of server-sent events with subsequent changes in the result
+func SSEURL() QueryOption {
+	return func(q *Query) {
+		q.sseURL = true
+	}
+}
+
+// Where adds one or more filter expressions to the query. Expressions are combined with AND.
+func Where(filters ...Filter) QueryOption {
+	return func(q *Query) {
+		q.filters = append(q.filters, filters...)
+	}
+}
+
+// Include limits the result to the given fields
+func Include(fields ...string) QueryOption {
+	return func(q *Query) {
+		q.includes = append(q.includes, fields...)
+	}
+}
+
+// Exclude removes the given fields from the result
+func Exclude(fields ...string) QueryOption {
+	return func(q *Query) {
+		q.excludes = append(q.excludes, fields...)
+	}
+}
+
+// Fingerprint returns a short digest of the query, disregarding its change id, that can be used
+// to tell whether a previously stored change id belongs to an identical query
+func (q Query) Fingerprint() string {
+	q.changeID = ""
+
+	b, _ := xml.Marshal(q)
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+func (q Query) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "QUERY"}
+	start.Attr = []xml.Attr{{Name: xml.Name{Local: "objecttype"}, Value: q.objectType}}
+
+	addAttr := func(name, value string) {
+		if value != "" {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+		}
+	}
+
+	addAttr("namespace", q.namespace)
+	addAttr("schemaversion", q.schemaVersion)
+	addAttr("changeid", q.changeID)
+
+	if q.includeDeletedObjects {
+		addAttr("includedeletedobjects", "true")
+	}
+
+	if q.limit > 0 {
+		addAttr("limit", strconv.Itoa(q.limit))
+	}
+
+	addAttr("orderby", q.orderBy)
+
+	if q.sseURL {
+		addAttr("sseurl", "true")
+	}
+
+	err := e.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+
+	if len(q.filters) > 0 {
+		err = e.EncodeElement(filterElement{Filters: q.filters}, xml.StartElement{Name: xml.Name{Local: "FILTER"}})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range q.includes {
+		err = e.EncodeElement(field, xml.StartElement{Name: xml.Name{Local: "INCLUDE"}})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range q.excludes {
+		err = e.EncodeElement(field, xml.StartElement{Name: xml.Name{Local: "EXCLUDE"}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+type filterElement struct {
+	Filters []Filter
+}
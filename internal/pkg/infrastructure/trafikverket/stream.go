@@ -0,0 +1,86 @@
+package trafikverket
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Info is the INFO element of a query result
+type Info struct {
+	LastChangeID string `json:"LASTCHANGEID"`
+	SSEURL       string `json:"SSEURL"`
+}
+
+var ErrStreamClosed = errors.New("stream closed by server")
+
+// Stream connects to a server-sent events URL, as returned in the INFO of a query with the SSEURL option,
+// and calls onEvent with the data of each event. Stream blocks until the stream is closed by the server,
+// the connection fails or ctx is cancelled, in which case nil is returned.
+func (c *tfvClient) Stream(ctx context.Context, sseURL string, onEvent func(ctx context.Context, data []byte)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sseURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %s", err.Error())
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.streamClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to connect to event stream: %s", err.Error())
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status code %d from event stream, but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	err = readEvents(ctx, resp.Body, func(data []byte) { onEvent(ctx, data) })
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
+
+// readEvents parses a text/event-stream and calls dispatch with the data of each complete event, until
+// ctx is done
+func readEvents(ctx context.Context, r io.Reader, dispatch func(data []byte)) error {
+	reader := bufio.NewReader(r)
+	data := []string{}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return ErrStreamClosed
+			}
+			return fmt.Errorf("failed to read from event stream: %s", err.Error())
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if len(data) > 0 {
+				dispatch([]byte(strings.Join(data, "\n")))
+				data = data[:0]
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		if field == "data" {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package trafikverket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrRequestFailed is matched by every error returned by Query
+var ErrRequestFailed = errors.New("trafikverket request failed")
+
+// ErrUnavailable is matched by the errors returned when the Trafikverket API could not be reached or
+// responded with a server error or 429 Too Many Requests, even after retrying
+var ErrUnavailable = errors.New("trafikverket api unavailable")
+
+type requestError struct {
+	msg         string
+	unavailable bool
+	retryAfter  time.Duration
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+func (e *requestError) Is(target error) bool {
+	return target == ErrRequestFailed || (e.unavailable && target == ErrUnavailable)
+}
+
+// RetryAfter returns how long the Trafikverket API asked the client to wait before trying again, if
+// err is an ErrUnavailable from a response with a Retry-After header, or zero otherwise
+func RetryAfter(err error) time.Duration {
+	var re *requestError
+	if errors.As(err, &re) {
+		return re.retryAfter
+	}
+	return 0
+}
+
+// Retries sets how many times a request to the Trafikverket API is attempted before giving up, and the
+// delay before the first retry that is doubled, up to maxBackoff, for every retry that follows
+func Retries(attempts int, initialBackoff, maxBackoff time.Duration) func(*tfvClient) {
+	return func(c *tfvClient) {
+		c.retries.attempts = max(attempts, 1)
+		c.retries.initialBackoff = initialBackoff
+		c.retries.maxBackoff = maxBackoff
+	}
+}
+
+// retryTransport retries requests that fail with a network error, a server error or 429 Too Many
+// Requests, with a jittered exponential backoff. Any other response, such as 400 Bad Request or
+// 401 Unauthorized, is returned at once. Every attempt is given its own timeout.
+type retryTransport struct {
+	next http.RoundTripper
+
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.try(req)
+
+		retryAfter, retry := t.shouldRetry(resp, err)
+		if !retry || attempt >= t.attempts || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if retryAfter > delay {
+			if retryAfter > t.maxBackoff {
+				// waiting longer than this would stall the caller, so let it decide when to try again
+				return resp, err
+			}
+			delay = retryAfter
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// try sends a single attempt of req, with a fresh copy of its body and a timeout that lasts until the
+// response body is closed
+func (t *retryTransport) try(req *http.Request) (*http.Response, error) {
+	attempt := req
+
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %s", err.Error())
+		}
+		attempt = req.Clone(req.Context())
+		attempt.Body = body
+	}
+
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(attempt)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(attempt.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// shouldRetry classifies the outcome of an attempt and returns the delay requested by a Retry-After header
+func (t *retryTransport) shouldRetry(resp *http.Response, err error) (time.Duration, bool) {
+	if err != nil {
+		return 0, true
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return parseRetryAfter(resp.Header.Get("Retry-After")), true
+	}
+
+	return 0, false
+}
+
+// backoff returns a random delay between half and all of the exponential backoff for an attempt
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	backoff := t.initialBackoff << (attempt - 1)
+	if backoff > t.maxBackoff || backoff <= 0 {
+		backoff = t.maxBackoff
+	}
+
+	if backoff <= 1 {
+		return backoff
+	}
+
+	return backoff/2 + rand.N(backoff/2)
+}
+
+// parseRetryAfter parses the value of a Retry-After header, given either in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,121 @@
+package trafikverket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestThatServerErrorsAreRetried(t *testing.T) {
+	is := is.New(t)
+	attempts := atomic.Int32{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		is.True(len(body) > 0) // every attempt should send the complete request body
+
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"RESPONSE":{}}`))
+	}))
+	defer server.Close()
+
+	c := NewClient("key", server.URL, Retries(3, time.Millisecond, 10*time.Millisecond))
+	body, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+
+	is.NoErr(err)
+	is.Equal(string(body), `{"RESPONSE":{}}`)
+	is.Equal(attempts.Load(), int32(3))
+}
+
+func TestThatClientErrorsAreNotRetried(t *testing.T) {
+	for _, statusCode := range []int{http.StatusBadRequest, http.StatusUnauthorized} {
+		is := is.New(t)
+		attempts := atomic.Int32{}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(statusCode)
+		}))
+
+		c := NewClient("key", server.URL, Retries(3, time.Millisecond, 10*time.Millisecond))
+		_, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+		server.Close()
+
+		is.True(err != nil)                      // expected an error but got none
+		is.True(!errors.Is(err, ErrUnavailable)) // a client error should not be reported as unavailable
+		is.Equal(attempts.Load(), int32(1))      // a client error should not be retried
+	}
+}
+
+func TestThatRetryAfterIsHonoured(t *testing.T) {
+	is := is.New(t)
+	attempts := []time.Time{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, time.Now())
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := NewClient("key", server.URL, Retries(2, time.Millisecond, 2*time.Second))
+	_, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+
+	is.True(errors.Is(err, ErrUnavailable))
+	is.Equal(RetryAfter(err), time.Second)
+	is.Equal(len(attempts), 2)
+	is.True(attempts[1].Sub(attempts[0]) >= time.Second) // the retry should wait as long as the server asked for
+}
+
+func TestThatLongRetryAfterIsLeftToTheCaller(t *testing.T) {
+	is := is.New(t)
+	attempts := atomic.Int32{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := NewClient("key", server.URL, Retries(3, time.Millisecond, 10*time.Millisecond))
+	_, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+
+	is.True(errors.Is(err, ErrUnavailable))
+	is.Equal(RetryAfter(err), time.Hour)
+	is.Equal(attempts.Load(), int32(1))
+}
+
+func TestThatNetworkErrorsAreReportedAsUnavailable(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	url := server.URL
+	server.Close()
+
+	c := NewClient("key", url, Retries(2, time.Millisecond, 10*time.Millisecond))
+	_, err := c.Query(context.Background(), NewQuery("WeatherMeasurepoint", "2.1"))
+
+	is.True(errors.Is(err, ErrUnavailable))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(parseRetryAfter("120"), 2*time.Minute)
+	is.Equal(parseRetryAfter(""), time.Duration(0))
+	is.Equal(parseRetryAfter("soon"), time.Duration(0))
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	is.True(parseRetryAfter(date) > 59*time.Minute)
+}